@@ -0,0 +1,422 @@
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v2 "hashmap/v2"
+)
+
+// keydir使用v2的hmap，val为entry
+type keydir interface {
+	Set(key string, val interface{})
+	Get(key string) (interface{}, bool)
+	Delete(key string)
+	Count() int
+	Range(f func(key string, val interface{}) bool)
+}
+
+type Options struct {
+	MaxFileSize int64 // 单个数据文件的大小上限，默认256MB
+	Sync        bool  // 每次写入后sync
+}
+
+// 日志结构的key/value存储
+// 所有写入追加到活跃数据文件，内存中的keydir记录每个key最新记录的位置
+// 并发安全，Get只持有读锁
+type DB struct {
+	mu     sync.RWMutex
+	dir    string
+	opts   Options
+	keydir keydir
+	files  map[uint32]*dataFile // 所有数据文件，包括活跃文件
+	active *dataFile
+	buf    []byte
+	now    func() int64
+	closed bool
+}
+
+func Open(dir string, opts *Options) (*DB, error) {
+	db := &DB{
+		dir:    dir,
+		keydir: v2.NewHMap(0),
+		files:  make(map[uint32]*dataFile),
+		now:    func() int64 { return time.Now().UnixNano() },
+	}
+	if opts != nil {
+		db.opts = *opts
+	}
+	if db.opts.MaxFileSize <= 0 {
+		db.opts.MaxFileSize = 256 << 20
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := db.load(); err != nil {
+		db.closeFiles()
+		return nil, err
+	}
+	return db, nil
+}
+
+// 按文件id从小到大加载，有hint文件的直接读hint，否则扫描数据文件
+// 最后一个数据文件末尾不完整的记录是写入时崩溃留下的，直接截断
+// 加载完成后总是新建一个活跃文件
+func (db *DB) load() error {
+	ids, err := listDataFiles(db.dir)
+	if err != nil {
+		return err
+	}
+	for i, id := range ids {
+		df, err := openDataFile(db.dir, id, false)
+		if err != nil {
+			return err
+		}
+		db.files[id] = df
+		err = readHintFile(db.dir, id, func(key []byte, e entry) {
+			db.keydir.Set(string(key), e)
+		})
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, os.ErrNotExist) && !errors.Is(err, ErrCorrupt) {
+			return err
+		}
+		valid, err := df.scan(func(key []byte, e entry, deleted bool) {
+			if deleted {
+				db.keydir.Delete(string(key))
+			} else {
+				db.keydir.Set(string(key), e)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		if valid < df.size {
+			if i != len(ids)-1 {
+				return fmt.Errorf("%w: %s at offset %d", ErrCorrupt, dataFileName(db.dir, id), valid)
+			}
+			if err := os.Truncate(dataFileName(db.dir, id), valid); err != nil {
+				return err
+			}
+			df.size = valid
+		}
+	}
+	var next uint32
+	if len(ids) > 0 {
+		next = ids[len(ids)-1] + 1
+	}
+	return db.newActive(next)
+}
+
+func (db *DB) newActive(id uint32) error {
+	df, err := openDataFile(db.dir, id, true)
+	if err != nil {
+		return err
+	}
+	db.files[id] = df
+	db.active = df
+	return nil
+}
+
+// 当前活跃文件sync后变为只读，新建下一个活跃文件
+func (db *DB) rotate() error {
+	if err := db.active.f.Sync(); err != nil {
+		return err
+	}
+	return db.newActive(db.active.id + 1)
+}
+
+// 追加一条记录，超过文件大小上限时先切换活跃文件
+func (db *DB) write(key string, val []byte, deleted bool) (entry, error) {
+	if db.closed {
+		return entry{}, ErrClosed
+	}
+	if len(key) > maxKeySize {
+		return entry{}, ErrKeyTooLarge
+	}
+	if int64(len(val)) > maxValSize {
+		return entry{}, ErrValTooLarge
+	}
+	tstamp := db.now()
+	db.buf = encodeRecord(db.buf, key, val, tstamp, deleted)
+	if db.active.size > 0 && db.active.size+int64(len(db.buf)) > db.opts.MaxFileSize {
+		if err := db.rotate(); err != nil {
+			return entry{}, err
+		}
+	}
+	offset, err := db.active.append(db.buf)
+	if err != nil {
+		return entry{}, err
+	}
+	if db.opts.Sync {
+		if err := db.active.f.Sync(); err != nil {
+			return entry{}, err
+		}
+	}
+	return entry{fileID: db.active.id, offset: offset, size: uint32(len(db.buf)), tstamp: tstamp}, nil
+}
+
+func (db *DB) Put(key string, val []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	e, err := db.write(key, val, false)
+	if err != nil {
+		return err
+	}
+	db.keydir.Set(key, e)
+	return nil
+}
+
+// 通过keydir定位记录，一次ReadAt读取，key不存在返回ErrNotFound
+func (db *DB) Get(key string) ([]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	v, ok := db.keydir.Get(key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	e := v.(entry)
+	k, val, err := db.files[e.fileID].read(e)
+	if err != nil {
+		return nil, err
+	}
+	if string(k) != key {
+		return nil, ErrCorrupt
+	}
+	return val, nil
+}
+
+// 写入删除记录，key不存在时不写入
+func (db *DB) Delete(key string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if _, ok := db.keydir.Get(key); !ok {
+		return nil
+	}
+	if _, err := db.write(key, nil, true); err != nil {
+		return err
+	}
+	db.keydir.Delete(key)
+	return nil
+}
+
+func (db *DB) Count() int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.keydir.Count()
+}
+
+// 遍历所有key，先在写锁内复制所有key，再在锁外调用f，f中可以修改DB
+// 开始遍历可能完成keydir的缩容，需要写锁
+func (db *DB) Keys(f func(key string) bool) {
+	db.mu.Lock()
+	keys := make([]string, 0, db.keydir.Count())
+	db.keydir.Range(func(key string, _ interface{}) bool {
+		keys = append(keys, key)
+		return true
+	})
+	db.mu.Unlock()
+	for _, key := range keys {
+		if !f(key) {
+			return
+		}
+	}
+}
+
+// 将活跃文件写入磁盘
+func (db *DB) Sync() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	return db.active.f.Sync()
+}
+
+// 合并所有旧的数据文件，只保留keydir中最新的记录，同时生成hint文件
+// 先切换活跃文件，合并结果写入id更大的新文件，全部写入后再按id从小到大删除旧文件
+// 任意时刻崩溃，旧文件和合并文件按id顺序加载的结果都与合并前一致
+// 合并期间持有写锁
+func (db *DB) Merge() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	last := db.active.id
+	if err := db.active.f.Sync(); err != nil {
+		return err
+	}
+
+	m := &merger{db: db, id: last}
+	var err error
+	db.keydir.Range(func(key string, v interface{}) bool {
+		err = m.copy(key, v.(entry))
+		return err == nil
+	})
+	if err == nil {
+		err = m.finish()
+	}
+	if err != nil {
+		m.abort()
+		return err
+	}
+	if err := db.newActive(m.id + 1); err != nil {
+		m.abort()
+		return err
+	}
+	for key, e := range m.moved {
+		db.keydir.Set(key, e)
+	}
+	for id := range m.files {
+		db.files[id] = m.files[id]
+	}
+
+	var old []uint32
+	for id := range db.files {
+		if id <= last {
+			old = append(old, id)
+		}
+	}
+	sort.Slice(old, func(i, j int) bool { return old[i] < old[j] })
+	for _, id := range old {
+		db.files[id].close()
+		delete(db.files, id)
+		err = errors.Join(err, os.Remove(dataFileName(db.dir, id)))
+		if rerr := os.Remove(hintFileName(db.dir, id)); rerr != nil && !errors.Is(rerr, os.ErrNotExist) {
+			err = errors.Join(err, rerr)
+		}
+	}
+	return err
+}
+
+// 将存活的记录复制到新的数据文件
+type merger struct {
+	db    *DB
+	id    uint32
+	out   *dataFile
+	hints []byte
+	moved map[string]entry
+	files map[uint32]*dataFile
+}
+
+func (m *merger) copy(key string, e entry) error {
+	_, val, err := m.db.files[e.fileID].read(e)
+	if err != nil {
+		return err
+	}
+	m.db.buf = encodeRecord(m.db.buf, key, val, e.tstamp, false)
+	if m.out == nil || m.out.size > 0 && m.out.size+int64(len(m.db.buf)) > m.db.opts.MaxFileSize {
+		if err := m.next(); err != nil {
+			return err
+		}
+	}
+	offset, err := m.out.append(m.db.buf)
+	if err != nil {
+		return err
+	}
+	ne := entry{fileID: m.out.id, offset: offset, size: uint32(len(m.db.buf)), tstamp: e.tstamp}
+	m.hints = appendHint(m.hints, key, ne)
+	if m.moved == nil {
+		m.moved = make(map[string]entry)
+	}
+	m.moved[key] = ne
+	return nil
+}
+
+// 完成当前的合并文件，新建下一个
+func (m *merger) next() error {
+	if err := m.finish(); err != nil {
+		return err
+	}
+	df, err := openDataFile(m.db.dir, m.id+1, true)
+	if err != nil {
+		return err
+	}
+	m.id++
+	m.out = df
+	if m.files == nil {
+		m.files = make(map[uint32]*dataFile)
+	}
+	m.files[df.id] = df
+	return nil
+}
+
+// sync当前的合并文件并写入hint文件
+func (m *merger) finish() error {
+	if m.out == nil {
+		return nil
+	}
+	if err := m.out.f.Sync(); err != nil {
+		return err
+	}
+	if err := writeHintFile(m.db.dir, m.out.id, m.hints); err != nil {
+		return err
+	}
+	m.hints = m.hints[:0]
+	return nil
+}
+
+// 合并失败时删除已经写入的合并文件
+func (m *merger) abort() {
+	for id, df := range m.files {
+		df.close()
+		os.Remove(dataFileName(m.db.dir, id))
+		os.Remove(hintFileName(m.db.dir, id))
+	}
+}
+
+func (db *DB) closeFiles() error {
+	var err error
+	for _, df := range db.files {
+		err = errors.Join(err, df.close())
+	}
+	return err
+}
+
+// sync活跃文件，关闭所有文件，活跃文件为空时删除
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return nil
+	}
+	db.closed = true
+	err := db.active.f.Sync()
+	err = errors.Join(err, db.closeFiles())
+	if db.active.size == 0 {
+		err = errors.Join(err, os.Remove(dataFileName(db.dir, db.active.id)))
+	}
+	return err
+}
+
+// 目录下所有数据文件的id，从小到大排序
+func listDataFiles(dir string) ([]uint32, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint32
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, ".data") {
+			continue
+		}
+		var id uint32
+		if _, err := fmt.Sscanf(name, dataFileFmt, &id); err == nil && name == filepath.Base(dataFileName(dir, id)) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
@@ -0,0 +1,233 @@
+package bitcask
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBitcask1(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	db, err := Open(dir, nil)
+	assert.Nil(err)
+	assert.Nil(db.Put("a", []byte("1")))
+	assert.Nil(db.Put("b", []byte("2")))
+	assert.Nil(db.Put("a", []byte("3")))
+	assert.Nil(db.Put("empty", nil))
+	val, err := db.Get("a")
+	assert.Nil(err)
+	assert.Equal([]byte("3"), val)
+	val, err = db.Get("empty")
+	assert.Nil(err)
+	assert.Len(val, 0)
+	assert.Nil(db.Delete("b"))
+	assert.Nil(db.Delete("c"))
+	_, err = db.Get("b")
+	assert.Equal(ErrNotFound, err)
+	assert.Equal(2, db.Count())
+	assert.Nil(db.Close())
+	_, err = db.Get("a")
+	assert.Equal(ErrClosed, err)
+
+	db, err = Open(dir, nil)
+	assert.Nil(err)
+	assert.Equal(2, db.Count())
+	val, _ = db.Get("a")
+	assert.Equal([]byte("3"), val)
+	_, err = db.Get("b")
+	assert.Equal(ErrNotFound, err)
+	assert.Nil(db.Close())
+}
+
+// 删除触发keydir缩容时并发遍历和读取
+func TestBitcaskKeysConcurrent(t *testing.T) {
+	assert := assert.New(t)
+	db, err := Open(t.TempDir(), nil)
+	assert.Nil(err)
+	for i := 0; i < 2000; i++ {
+		assert.Nil(db.Put(strconv.Itoa(i), []byte("v")))
+	}
+	// 每次删除后两个goroutine同时遍历，缩容中开始遍历会完成缩容
+	for i := 0; i < 2000; i++ {
+		assert.Nil(db.Delete(strconv.Itoa(i)))
+		var wg sync.WaitGroup
+		for g := 0; g < 2; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				db.Keys(func(key string) bool {
+					return true
+				})
+				db.Get("1999")
+			}()
+		}
+		wg.Wait()
+	}
+	assert.Equal(0, db.Count())
+	assert.Nil(db.Close())
+}
+
+// 测试超过大小上限切换数据文件
+func TestBitcaskRotate(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	db, err := Open(dir, &Options{MaxFileSize: 256})
+	assert.Nil(err)
+	for i := 0; i < 100; i++ {
+		assert.Nil(db.Put(strconv.Itoa(i), []byte(strconv.Itoa(i*i))))
+	}
+	assert.Greater(len(db.files), 10)
+	assert.Nil(db.Close())
+
+	db, err = Open(dir, &Options{MaxFileSize: 256})
+	assert.Nil(err)
+	for i := 0; i < 100; i++ {
+		val, err := db.Get(strconv.Itoa(i))
+		assert.Nil(err)
+		assert.Equal(strconv.Itoa(i*i), string(val))
+	}
+	assert.Nil(db.Close())
+}
+
+// 测试合并后只保留存活的记录，并生成hint文件
+func TestBitcaskMerge(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	opts := &Options{MaxFileSize: 1 << 10}
+	db, err := Open(dir, opts)
+	assert.Nil(err)
+	for round := 0; round < 10; round++ {
+		for i := 0; i < 50; i++ {
+			assert.Nil(db.Put(strconv.Itoa(i), []byte(strconv.Itoa(round))))
+		}
+	}
+	for i := 0; i < 50; i += 2 {
+		assert.Nil(db.Delete(strconv.Itoa(i)))
+	}
+	before := dirSize(dir)
+	assert.Nil(db.Merge())
+	assert.Less(dirSize(dir)*4, before)
+	hints, _ := filepath.Glob(filepath.Join(dir, "*.hint"))
+	assert.NotEmpty(hints)
+	assert.Nil(db.Put("new", []byte("x")))
+	check := func() {
+		assert.Equal(26, db.Count())
+		for i := 0; i < 50; i++ {
+			val, err := db.Get(strconv.Itoa(i))
+			if i%2 == 0 {
+				assert.Equal(ErrNotFound, err)
+			} else {
+				assert.Nil(err)
+				assert.Equal("9", string(val))
+			}
+		}
+		val, _ := db.Get("new")
+		assert.Equal("x", string(val))
+	}
+	check()
+	assert.Nil(db.Close())
+
+	db, err = Open(dir, opts)
+	assert.Nil(err)
+	check()
+	assert.Nil(db.Merge())
+	assert.Nil(db.Merge())
+	check()
+	assert.Nil(db.Close())
+}
+
+// 测试合并中途崩溃，旧文件和合并文件同时存在
+func TestBitcaskMergeCrash(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	db, err := Open(dir, nil)
+	assert.Nil(err)
+	assert.Nil(db.Put("a", []byte("1")))
+	assert.Nil(db.Put("b", []byte("2")))
+	assert.Nil(db.Delete("b"))
+	assert.Nil(db.Put("a", []byte("3")))
+	old, _ := os.ReadFile(dataFileName(dir, 0))
+	assert.Nil(db.Merge())
+	assert.Nil(db.Close())
+	// 恢复被删除的旧文件
+	assert.Nil(os.WriteFile(dataFileName(dir, 0), old, 0o644))
+
+	db, err = Open(dir, nil)
+	assert.Nil(err)
+	assert.Equal(1, db.Count())
+	val, _ := db.Get("a")
+	assert.Equal("3", string(val))
+	assert.Nil(db.Close())
+}
+
+// 测试末尾不完整的记录被截断
+func TestBitcaskTornTail(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	db, err := Open(dir, nil)
+	assert.Nil(err)
+	assert.Nil(db.Put("a", []byte("1")))
+	assert.Nil(db.Put("b", []byte("2")))
+	assert.Nil(db.Close())
+
+	name := dataFileName(dir, 0)
+	data, _ := os.ReadFile(name)
+	for n := len(data) - 1; n >= 0; n-- {
+		assert.Nil(os.WriteFile(name, data[:n], 0o644))
+		db, err = Open(dir, nil)
+		assert.Nil(err)
+		want := 0
+		if n >= len(data)/2 {
+			want = 1
+		}
+		assert.Equal(want, db.Count(), n)
+		assert.Nil(db.Close())
+		fi, _ := os.Stat(name)
+		assert.Equal(int64(want*len(data)/2), fi.Size())
+	}
+}
+
+// 测试中间的数据文件损坏时返回错误，hint文件损坏时扫描数据文件
+func TestBitcaskCorrupt(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	db, err := Open(dir, nil)
+	assert.Nil(err)
+	assert.Nil(db.Put("a", []byte("1")))
+	assert.Nil(db.Merge())
+	assert.Nil(db.Put("b", []byte("2")))
+	assert.Nil(db.Close())
+
+	ids, _ := listDataFiles(dir)
+	assert.Len(ids, 2)
+	hint := hintFileName(dir, ids[0])
+	assert.Nil(os.WriteFile(hint, []byte("bad"), 0o644))
+	db, err = Open(dir, nil)
+	assert.Nil(err)
+	val, _ := db.Get("a")
+	assert.Equal("1", string(val))
+	assert.Nil(db.Close())
+
+	name := dataFileName(dir, ids[0])
+	data, _ := os.ReadFile(name)
+	data[len(data)-1] ^= 0xff
+	assert.Nil(os.WriteFile(name, data, 0o644))
+	os.Remove(hint)
+	_, err = Open(dir, nil)
+	assert.ErrorIs(err, ErrCorrupt)
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		fi, _ := e.Info()
+		size += fi.Size()
+	}
+	return size
+}
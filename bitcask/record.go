@@ -0,0 +1,265 @@
+package bitcask
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// 数据文件中的记录格式，整数均为小端序
+//
+//	record: crc32[4] tstamp[8] keySize[4] valSize[4] key val
+//
+// crc32为之后所有字节的CRC32(IEEE)，删除写入valSize为tombstone，没有val
+//
+// hint文件对应合并后的数据文件，只保存keydir需要的信息，最后是整个文件的CRC32
+//
+//	hint:   tstamp[8] keySize[4] size[4] offset[8] key
+const (
+	recordHeader = 4 + 8 + 4 + 4
+	hintHeader   = 8 + 4 + 4 + 8
+	tombstone    = math.MaxUint32
+	maxKeySize   = 1 << 16
+	maxValSize   = 1 << 31
+	dataFileFmt  = "%09d.data"
+	hintFileFmt  = "%09d.hint"
+)
+
+var (
+	ErrNotFound    = errors.New("bitcask: not found")
+	ErrCorrupt     = errors.New("bitcask: corrupt record")
+	ErrKeyTooLarge = errors.New("bitcask: key too large")
+	ErrValTooLarge = errors.New("bitcask: value too large")
+	ErrClosed      = errors.New("bitcask: closed")
+)
+
+// keydir中的值，指向key最新的记录
+type entry struct {
+	fileID uint32
+	offset int64  // 记录在文件中的偏移
+	size   uint32 // 整条记录的长度
+	tstamp int64  // 写入时间，UnixNano
+}
+
+func encodeRecord(buf []byte, key string, val []byte, tstamp int64, deleted bool) []byte {
+	valSize := uint32(len(val))
+	if deleted {
+		valSize = tombstone
+	}
+	buf = buf[:0]
+	buf = append(buf, make([]byte, recordHeader)...)
+	binary.LittleEndian.PutUint64(buf[4:], uint64(tstamp))
+	binary.LittleEndian.PutUint32(buf[12:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(buf[16:], valSize)
+	buf = append(buf, key...)
+	buf = append(buf, val...)
+	binary.LittleEndian.PutUint32(buf, crc32.ChecksumIEEE(buf[4:]))
+	return buf
+}
+
+// 解析header，返回key和val的长度，整条记录的长度
+func decodeHeader(header []byte) (keySize uint32, valSize uint32, size int64, err error) {
+	keySize = binary.LittleEndian.Uint32(header[12:])
+	valSize = binary.LittleEndian.Uint32(header[16:])
+	if keySize > maxKeySize {
+		return 0, 0, 0, ErrCorrupt
+	}
+	size = recordHeader + int64(keySize)
+	if valSize != tombstone {
+		if valSize > maxValSize {
+			return 0, 0, 0, ErrCorrupt
+		}
+		size += int64(valSize)
+	}
+	return keySize, valSize, size, nil
+}
+
+// 校验一条完整的记录，返回key，val，时间戳，是否为删除
+func decodeRecord(buf []byte) (key []byte, val []byte, tstamp int64, deleted bool, err error) {
+	if len(buf) < recordHeader {
+		return nil, nil, 0, false, ErrCorrupt
+	}
+	keySize, valSize, size, err := decodeHeader(buf)
+	if err != nil {
+		return nil, nil, 0, false, err
+	}
+	if int64(len(buf)) != size || crc32.ChecksumIEEE(buf[4:]) != binary.LittleEndian.Uint32(buf) {
+		return nil, nil, 0, false, ErrCorrupt
+	}
+	tstamp = int64(binary.LittleEndian.Uint64(buf[4:]))
+	key = buf[recordHeader : recordHeader+keySize]
+	return key, buf[recordHeader+keySize:], tstamp, valSize == tombstone, nil
+}
+
+// 数据文件，只有活跃文件可以追加写入
+type dataFile struct {
+	id   uint32
+	f    *os.File
+	size int64
+}
+
+func openDataFile(dir string, id uint32, write bool) (*dataFile, error) {
+	flag := os.O_RDONLY
+	if write {
+		flag = os.O_CREATE | os.O_RDWR | os.O_APPEND
+	}
+	f, err := os.OpenFile(dataFileName(dir, id), flag, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &dataFile{id: id, f: f, size: fi.Size()}, nil
+}
+
+// 追加一条记录，返回它的偏移
+// 只写入一部分时截断到写入前的大小，不留下不完整的记录
+func (df *dataFile) append(rec []byte) (int64, error) {
+	offset := df.size
+	n, err := df.f.Write(rec)
+	if err != nil {
+		if n > 0 {
+			if terr := df.f.Truncate(offset); terr != nil {
+				// 之后的写入仍然追加到文件末尾，size与文件保持一致
+				df.size += int64(n)
+				return 0, fmt.Errorf("%w, truncate: %v", err, terr)
+			}
+		}
+		return 0, err
+	}
+	df.size += int64(n)
+	return offset, nil
+}
+
+// 一次ReadAt读取整条记录并校验
+func (df *dataFile) read(e entry) ([]byte, []byte, error) {
+	buf := make([]byte, e.size)
+	if _, err := df.f.ReadAt(buf, e.offset); err != nil {
+		if err == io.EOF {
+			err = ErrCorrupt
+		}
+		return nil, nil, err
+	}
+	key, val, _, deleted, err := decodeRecord(buf)
+	if err == nil && deleted {
+		err = ErrCorrupt
+	}
+	return key, val, err
+}
+
+// 顺序扫描所有完整的记录，返回最后一条完整记录之后的偏移
+// 遇到不完整或校验失败的记录就停止
+func (df *dataFile) scan(f func(key []byte, e entry, deleted bool)) (int64, error) {
+	r := bufio.NewReader(io.NewSectionReader(df.f, 0, df.size))
+	var offset int64
+	header := make([]byte, recordHeader)
+	var buf []byte
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return offset, nil
+		}
+		_, _, size, err := decodeHeader(header)
+		if err != nil || offset+size > df.size {
+			return offset, nil
+		}
+		if int64(cap(buf)) < size {
+			buf = make([]byte, size)
+		}
+		buf = buf[:size]
+		copy(buf, header)
+		if _, err := io.ReadFull(r, buf[recordHeader:]); err != nil {
+			return offset, nil
+		}
+		key, _, tstamp, deleted, err := decodeRecord(buf)
+		if err != nil {
+			return offset, nil
+		}
+		f(key, entry{fileID: df.id, offset: offset, size: uint32(size), tstamp: tstamp}, deleted)
+		offset += size
+	}
+}
+
+func (df *dataFile) close() error {
+	return df.f.Close()
+}
+
+func dataFileName(dir string, id uint32) string {
+	return filepath.Join(dir, fmt.Sprintf(dataFileFmt, id))
+}
+
+func hintFileName(dir string, id uint32) string {
+	return filepath.Join(dir, fmt.Sprintf(hintFileFmt, id))
+}
+
+func appendHint(buf []byte, key string, e entry) []byte {
+	var h [hintHeader]byte
+	binary.LittleEndian.PutUint64(h[:], uint64(e.tstamp))
+	binary.LittleEndian.PutUint32(h[8:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(h[12:], e.size)
+	binary.LittleEndian.PutUint64(h[16:], uint64(e.offset))
+	buf = append(buf, h[:]...)
+	return append(buf, key...)
+}
+
+// 先写入临时文件再重命名，hint文件要么完整要么不存在
+func writeHintFile(dir string, id uint32, hints []byte) error {
+	name := hintFileName(dir, id)
+	hints = binary.LittleEndian.AppendUint32(hints, crc32.ChecksumIEEE(hints))
+	f, err := os.OpenFile(name+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(hints)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(name+".tmp", name)
+}
+
+// 读取hint文件，校验失败返回ErrCorrupt
+func readHintFile(dir string, id uint32, f func(key []byte, e entry)) error {
+	data, err := os.ReadFile(hintFileName(dir, id))
+	if err != nil {
+		return err
+	}
+	if len(data) < 4 {
+		return ErrCorrupt
+	}
+	body := data[:len(data)-4]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(data[len(body):]) {
+		return ErrCorrupt
+	}
+	for len(body) > 0 {
+		if len(body) < hintHeader {
+			return ErrCorrupt
+		}
+		keySize := binary.LittleEndian.Uint32(body[8:])
+		if uint64(len(body)-hintHeader) < uint64(keySize) {
+			return ErrCorrupt
+		}
+		e := entry{
+			fileID: id,
+			tstamp: int64(binary.LittleEndian.Uint64(body)),
+			size:   binary.LittleEndian.Uint32(body[12:]),
+			offset: int64(binary.LittleEndian.Uint64(body[16:])),
+		}
+		f(body[hintHeader:hintHeader+keySize], e)
+		body = body[hintHeader+keySize:]
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package cdb
+
+import (
+	"bytes"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	v2 "hashmap/v2"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCDB1(t *testing.T) {
+	assert := assert.New(t)
+	for _, count := range []int{0, 1, 100, 1 << 14} {
+		m := v2.NewHMap(0)
+		for i := 0; i < count; i++ {
+			m.Set(strconv.Itoa(i), []byte(strconv.Itoa(i*i)))
+		}
+		m.Set("s", "啊啊啊")
+		m.Set("empty", []byte{})
+		name := filepath.Join(t.TempDir(), "test.cdb")
+		assert.Nil(FreezeFile(name, m))
+
+		r, err := Open(name)
+		assert.Nil(err)
+		assert.Equal(count+2, r.Count())
+		for i := 0; i < count; i++ {
+			val, ok := r.Get(strconv.Itoa(i))
+			assert.True(ok, i)
+			assert.Equal(strconv.Itoa(i*i), string(val))
+		}
+		val, ok := r.Get("s")
+		assert.True(ok)
+		assert.Equal("啊啊啊", string(val))
+		val, ok = r.Get("empty")
+		assert.True(ok)
+		assert.Len(val, 0)
+		_, ok = r.Get("x")
+		assert.False(ok)
+
+		n := 0
+		r.Range(func(key string, val []byte) bool {
+			v, _ := m.Get(key)
+			if b, ok := v.([]byte); ok {
+				assert.Equal(b, val)
+			}
+			n++
+			return true
+		})
+		assert.Equal(count+2, n)
+		assert.Nil(r.Close())
+	}
+}
+
+// 测试Get不分配内存
+func TestCDBAlloc(t *testing.T) {
+	assert := assert.New(t)
+	m := v2.NewHMap(0)
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		m.Set(keys[i], keys[i])
+	}
+	name := filepath.Join(t.TempDir(), "test.cdb")
+	assert.Nil(FreezeFile(name, m))
+	r, err := Open(name)
+	assert.Nil(err)
+	defer r.Close()
+	allocs := testing.AllocsPerRun(100, func() {
+		for _, key := range keys {
+			r.Get(key)
+		}
+		r.Get("missing")
+	})
+	assert.Equal(float64(0), allocs)
+}
+
+// 测试哈希函数的结果固定，文件在不同进程间可以通用
+func TestCDBHash(t *testing.T) {
+	assert := assert.New(t)
+	fnv := hashes[hashFNV1a]
+	assert.Equal(uint64(0xcbf29ce484222325), fnv.Hash(""))
+	assert.Equal(uint64(0xaf63dc4c8601ec8c), fnv.Hash("a"))
+	assert.Equal(uint64(0x85944171f73967e8), fnv.Hash("foobar"))
+	xxh := hashes[hashXXH64]
+	assert.Equal(uint64(0xef46db3751d8e999), xxh.Hash(""))
+	assert.Equal(uint64(0xd24ec4f1a98c6e5b), xxh.Hash("a"))
+
+	// 早期使用FNV-1a的文件仍然可以读取
+	m := v2.NewHMap(0)
+	for i := 0; i < 100; i++ {
+		m.Set(strconv.Itoa(i), strconv.Itoa(i))
+	}
+	var buf bytes.Buffer
+	assert.Nil(freeze(&buf, m, hashFNV1a))
+	assert.Equal(byte(hashFNV1a), buf.Bytes()[6])
+	r, err := NewReader(buf.Bytes())
+	assert.Nil(err)
+	for i := 0; i < 100; i++ {
+		val, ok := r.Get(strconv.Itoa(i))
+		assert.True(ok, i)
+		assert.Equal(strconv.Itoa(i), string(val))
+	}
+	buf.Bytes()[6] = 0
+	_, err = NewReader(buf.Bytes())
+	assert.Equal(ErrFormat, err)
+}
+
+// 测试无效的文件
+func TestCDBFormat(t *testing.T) {
+	assert := assert.New(t)
+	_, err := NewReader([]byte("HCDB"))
+	assert.Equal(ErrFormat, err)
+	var buf bytes.Buffer
+	assert.Nil(Freeze(&buf, v2.NewHMap(0)))
+	data := buf.Bytes()
+	data[0] = 'x'
+	_, err = NewReader(data)
+	assert.Equal(ErrFormat, err)
+
+	m := v2.NewHMap(0)
+	m.Set("a", 1)
+	assert.Equal(ErrValue, Freeze(&buf, m))
+}
+
+func BenchmarkCDBGet(b *testing.B) {
+	m := v2.NewHMap(0)
+	keys := make([]string, 1<<16)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		m.Set(keys[i], keys[i])
+	}
+	name := filepath.Join(b.TempDir(), "bench.cdb")
+	if err := FreezeFile(name, m); err != nil {
+		b.Fatal(err)
+	}
+	r, err := Open(name)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer r.Close()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Get(keys[i&(len(keys)-1)])
+	}
+}
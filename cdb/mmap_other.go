@@ -0,0 +1,21 @@
+//go:build !unix
+
+package cdb
+
+import (
+	"io"
+	"os"
+)
+
+// 不支持mmap时读取整个文件
+func mmap(f *os.File, size int) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func munmap(data []byte) error {
+	return nil
+}
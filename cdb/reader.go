@@ -0,0 +1,150 @@
+package cdb
+
+import (
+	"encoding/binary"
+	"os"
+
+	v2 "hashmap/v2"
+)
+
+// 只读的哈希表，数据直接引用文件内容，不需要加载
+// 并发安全
+type Reader struct {
+	data  []byte
+	count int
+	hash  v2.Hash // header中hashID对应的哈希函数
+	unmap func([]byte) error
+}
+
+// 使用mmap打开文件，打开时只校验header
+func Open(name string) (*Reader, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() < headerSize || fi.Size() != int64(int(fi.Size())) {
+		return nil, ErrFormat
+	}
+	data, err := mmap(f, int(fi.Size()))
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewReader(data)
+	if err != nil {
+		munmap(data)
+		return nil, err
+	}
+	r.unmap = munmap
+	return r, nil
+}
+
+// 直接使用内存中的数据，例如go:embed的文件，data在Reader使用期间不能修改
+func NewReader(data []byte) (*Reader, error) {
+	if len(data) < headerSize || string(data[:4]) != magic ||
+		binary.LittleEndian.Uint16(data[4:]) != version {
+		return nil, ErrFormat
+	}
+	hash, ok := hashes[data[6]]
+	if !ok {
+		return nil, ErrFormat
+	}
+	r := &Reader{data: data, hash: hash}
+	for t := 0; t < tableCount; t++ {
+		offset := binary.LittleEndian.Uint64(data[preamble+t*16:])
+		slots := binary.LittleEndian.Uint64(data[preamble+t*16+8:])
+		if offset > uint64(len(data)) || slots > (uint64(len(data))-offset)/slotSize {
+			return nil, ErrFormat
+		}
+		r.count += int(slots / 2)
+	}
+	return r, nil
+}
+
+// 返回的val引用文件内容，不能修改，Close之后不能再使用
+// 不分配内存
+func (r *Reader) Get(key string) ([]byte, bool) {
+	h := r.hash.Hash(key)
+	header := r.data[preamble+(h&0xff)*16:]
+	tableOffset := binary.LittleEndian.Uint64(header)
+	slots := binary.LittleEndian.Uint64(header[8:])
+	if slots == 0 {
+		return nil, false
+	}
+	slot := (h >> 8) % slots
+	for i := uint64(0); i < slots; i++ {
+		pos := tableOffset + slot*slotSize
+		offset := binary.LittleEndian.Uint64(r.data[pos+8:])
+		if offset == 0 {
+			return nil, false
+		}
+		if binary.LittleEndian.Uint64(r.data[pos:]) == h {
+			if val, ok := r.match(offset, key); ok {
+				return val, true
+			}
+		}
+		if slot++; slot == slots {
+			slot = 0
+		}
+	}
+	return nil, false
+}
+
+// 比较offset处记录的key，返回val
+func (r *Reader) match(offset uint64, key string) ([]byte, bool) {
+	k, val, ok := r.record(offset)
+	if !ok || string(k) != key {
+		return nil, false
+	}
+	return val, true
+}
+
+// 读取offset处的记录，越界时返回false
+func (r *Reader) record(offset uint64) ([]byte, []byte, bool) {
+	if offset > uint64(len(r.data))-8 {
+		return nil, nil, false
+	}
+	keyLen := uint64(binary.LittleEndian.Uint32(r.data[offset:]))
+	valLen := uint64(binary.LittleEndian.Uint32(r.data[offset+4:]))
+	start := offset + 8
+	if keyLen+valLen > uint64(len(r.data))-start {
+		return nil, nil, false
+	}
+	end := start + keyLen + valLen
+	return r.data[start : start+keyLen], r.data[start+keyLen : end : end], true
+}
+
+func (r *Reader) Count() int {
+	return r.count
+}
+
+// 遍历所有记录，按子表和槽位的顺序
+func (r *Reader) Range(f func(key string, val []byte) bool) {
+	for t := 0; t < tableCount; t++ {
+		tableOffset := binary.LittleEndian.Uint64(r.data[preamble+t*16:])
+		slots := binary.LittleEndian.Uint64(r.data[preamble+t*16+8:])
+		for s := uint64(0); s < slots; s++ {
+			offset := binary.LittleEndian.Uint64(r.data[tableOffset+s*slotSize+8:])
+			if offset == 0 {
+				continue
+			}
+			if key, val, ok := r.record(offset); ok && !f(string(key), val) {
+				return
+			}
+		}
+	}
+}
+
+func (r *Reader) Close() error {
+	if r.unmap == nil || r.data == nil {
+		r.data = nil
+		return nil
+	}
+	err := r.unmap(r.data)
+	r.data = nil
+	return err
+}
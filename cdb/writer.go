@@ -0,0 +1,159 @@
+package cdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+
+	v2 "hashmap/v2"
+)
+
+// 文件格式，整数均为小端序
+//
+//	header:  magic[4] version[2] hashID[1] pad[1]，256个子表(offset[8] slots[8])
+//	records: keyLen[4] valLen[4] key val
+//	tables:  每个子表slots个槽位 hash[8] offset[8]，offset为0表示空槽位
+//
+// key的哈希值低8位选择子表，其余位除以slots作为起始槽位，线性探测
+// hashID为hashes中哈希函数的id
+const (
+	magic      = "HCDB"
+	version    = 1
+	hashFNV1a  = 1 // FNV-1a，早期的文件使用
+	hashXXH64  = 2 // xxh64，种子为0，Freeze默认使用
+	tableCount = 256
+	preamble   = 8
+	headerSize = preamble + tableCount*16
+	slotSize   = 16
+	maxLen     = 1<<32 - 1
+)
+
+var (
+	ErrFormat = errors.New("cdb: invalid file")
+	ErrValue  = errors.New("cdb: value must be []byte or string")
+	ErrTooBig = errors.New("cdb: key or value too large")
+)
+
+// 可以遍历的map，v2的hmap和ConcurrentMap都实现了
+type Map interface {
+	Range(f func(key string, val interface{}) bool)
+}
+
+// 文件中可以使用的哈希函数，按hashID选择
+// 使用v2中不带种子或固定种子的哈希函数，hmap默认的maphash种子无法在进程间保持一致，不能用于文件
+var hashes = map[byte]v2.Hash{
+	hashFNV1a: v2.NewFNV1a(),
+	hashXXH64: v2.NewXXH64(0),
+}
+
+type record struct {
+	key    string
+	val    []byte
+	hash   uint64
+	offset uint64
+}
+
+// 将map冻结为只读的哈希表文件，val必须是[]byte或string
+func Freeze(w io.Writer, m Map) error {
+	return freeze(w, m, hashXXH64)
+}
+
+func freeze(w io.Writer, m Map, hashID byte) error {
+	hash := hashes[hashID]
+	var records []record
+	var err error
+	m.Range(func(key string, val interface{}) bool {
+		var b []byte
+		switch v := val.(type) {
+		case []byte:
+			b = v
+		case string:
+			b = []byte(v)
+		default:
+			err = ErrValue
+			return false
+		}
+		if uint64(len(key)) > maxLen || uint64(len(b)) > maxLen {
+			err = ErrTooBig
+			return false
+		}
+		records = append(records, record{key: key, val: b, hash: hash.Hash(key)})
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	// 先计算所有记录和子表的位置，再顺序写入
+	offset := uint64(headerSize)
+	var counts [tableCount]uint64
+	for i := range records {
+		records[i].offset = offset
+		offset += 8 + uint64(len(records[i].key)) + uint64(len(records[i].val))
+		counts[records[i].hash&0xff]++
+	}
+	var tables [tableCount][]uint64 // 每个子表中记录的下标+1，0表示空槽位
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	binary.LittleEndian.PutUint16(header[4:], version)
+	header[6] = hashID
+	for t := range tables {
+		slots := counts[t] * 2
+		tables[t] = make([]uint64, slots)
+		binary.LittleEndian.PutUint64(header[preamble+t*16:], offset)
+		binary.LittleEndian.PutUint64(header[preamble+t*16+8:], slots)
+		offset += slots * slotSize
+	}
+	for i, rec := range records {
+		table := tables[rec.hash&0xff]
+		slot := (rec.hash >> 8) % uint64(len(table))
+		for table[slot] != 0 {
+			slot = (slot + 1) % uint64(len(table))
+		}
+		table[slot] = uint64(i) + 1
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.Write(header)
+	var buf [slotSize]byte
+	for _, rec := range records {
+		binary.LittleEndian.PutUint32(buf[:], uint32(len(rec.key)))
+		binary.LittleEndian.PutUint32(buf[4:], uint32(len(rec.val)))
+		bw.Write(buf[:8])
+		bw.WriteString(rec.key)
+		bw.Write(rec.val)
+	}
+	for _, table := range tables {
+		for _, i := range table {
+			clear(buf[:])
+			if i != 0 {
+				binary.LittleEndian.PutUint64(buf[:], records[i-1].hash)
+				binary.LittleEndian.PutUint64(buf[8:], records[i-1].offset)
+			}
+			bw.Write(buf[:])
+		}
+	}
+	return bw.Flush()
+}
+
+// 冻结到文件，先写入临时文件再重命名
+func FreezeFile(name string, m Map) error {
+	f, err := os.Create(name + ".tmp")
+	if err != nil {
+		return err
+	}
+	err = Freeze(f, m)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name + ".tmp")
+		return err
+	}
+	return os.Rename(name+".tmp", name)
+}
@@ -0,0 +1,39 @@
+package cuckoo
+
+import (
+	"hash/maphash"
+)
+
+type Hash interface {
+	Seed() maphash.Seed
+	Hash(string) uint64
+}
+
+type mapHash struct {
+	h *maphash.Hash
+}
+
+func newMapHash(seed maphash.Seed) *mapHash {
+	mh := &mapHash{
+		h: new(maphash.Hash),
+	}
+	mh.h.SetSeed(seed)
+	return mh
+}
+
+// 使用两个不同的种子，得到两个相互独立的哈希函数
+func newMapHashes(seeds [2]maphash.Seed) [2]Hash {
+	return [2]Hash{newMapHash(seeds[0]), newMapHash(seeds[1])}
+}
+
+func (hash *mapHash) Seed() maphash.Seed {
+	return hash.h.Seed()
+}
+
+func (hash *mapHash) Hash(key string) uint64 {
+	hash.h.WriteString(key)
+	s := hash.h.Sum64()
+	// 清空缓存
+	hash.h.Reset()
+	return s
+}
@@ -0,0 +1,236 @@
+package cuckoo
+
+import (
+	"hash/maphash"
+	"math/rand"
+)
+
+const (
+	bucketSize = 4   // 每个桶的槽位个数
+	maxKicks   = 500 // 最多踢出的次数，超过则认为出现环
+)
+
+type hmap struct {
+	count   uint            // map内所有元素个数
+	b       uint8           // 当前设置2^b为桶的个数
+	buckets []bucket        // 所有桶
+	cap     uint            // 初始化时，预设的map容量
+	mapHash [2]Hash         // 两个hash函数
+	seeds   [2]maphash.Seed // 类似于hash0
+}
+
+func NewHMap(cap int) *hmap {
+	if cap < 0 || cap > 1<<30 {
+		panic("cap error")
+	}
+	return makemap(uint(cap))
+}
+
+func (hm *hmap) Set(key string, val interface{}) {
+	if hm.set(key, val) {
+		hm.count++
+	}
+}
+func (hm *hmap) Get(key string) (interface{}, bool) {
+	return hm.get(key)
+}
+func (hm *hmap) Delete(key string) {
+	if hm.del(key) {
+		hm.count--
+	}
+}
+func (hm *hmap) Count() int {
+	return int(hm.count)
+}
+
+// 返回值表示是否属于新增
+func (hm *hmap) set(key string, val interface{}) bool {
+	hash := hm.hash(key)
+	s, ok := hm.find(key, hash)
+	if ok {
+		s.val = val
+		return false
+	}
+	// 新增元素前判断是否需要扩容，扩容会更换种子，需要重新计算hash
+	if overLoadFactor(hm.count+1, hm.slotCount()) {
+		hm.rehash(hm.b+1, nil)
+		hash = hm.hash(key)
+	}
+	e := slot{used: true, hash: hash, key: key, val: val}
+	if e, ok := hm.insert(e); !ok {
+		// 出现环，手中被踢出的元素还没有位置，一起重建
+		hm.grow(e)
+	}
+	return true
+}
+
+// 只需要查找两个桶，最坏情况也是O(1)
+func (hm *hmap) get(key string) (interface{}, bool) {
+	s, ok := hm.find(key, hm.hash(key))
+	if ok {
+		return s.val, true
+	}
+	return nil, false
+}
+func (hm *hmap) del(key string) bool {
+	s, ok := hm.find(key, hm.hash(key))
+	if !ok {
+		return false
+	}
+	*s = slot{}
+	return true
+}
+
+// 分别计算两个hash值
+func (hm *hmap) hash(key string) [2]uint64 {
+	return [2]uint64{hm.mapHash[0].Hash(key), hm.mapHash[1].Hash(key)}
+}
+
+// 从两个候选桶中查找
+func (hm *hmap) find(key string, hash [2]uint64) (*slot, bool) {
+	for i := 0; i < 2; i++ {
+		bk := &hm.buckets[calbucket(hash[i], hm.b)]
+		for j := 0; j < bucketSize; j++ {
+			s := &bk.slots[j]
+			if s.used && s.hash == hash && s.key == key {
+				return s, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// 插入一个不存在的元素
+// 两个候选桶都满了，则随机踢出一个元素，被踢出的元素放到它的另一个候选桶中
+// 超过maxKicks次仍没有位置，返回false和手中被踢出的元素
+func (hm *hmap) insert(e slot) (slot, bool) {
+	index := calbucket(e.hash[0], hm.b)
+	for kicks := 0; kicks < maxKicks; kicks++ {
+		for i := 0; i < 2; i++ {
+			bk := &hm.buckets[calbucket(e.hash[i], hm.b)]
+			if j, ok := bk.getFree(); ok {
+				bk.slots[j] = e
+				return slot{}, true
+			}
+		}
+		// 踢出当前桶中随机的一个元素
+		bk := &hm.buckets[index]
+		j := rand.Intn(bucketSize)
+		bk.slots[j], e = e, bk.slots[j]
+		// 被踢出的元素去它的另一个候选桶
+		index = hm.altbucket(e, index)
+	}
+	return e, false
+}
+
+// 元素e在index桶中，返回它的另一个候选桶
+func (hm *hmap) altbucket(e slot, index uint64) uint64 {
+	i1 := calbucket(e.hash[0], hm.b)
+	if i1 != index {
+		return i1
+	}
+	return calbucket(e.hash[1], hm.b)
+}
+
+// 插入出现环时重建
+// 装载因子较低时，说明是哈希函数不好，更换种子等量重建，否则容量翻倍
+func (hm *hmap) grow(e slot) {
+	B := hm.b
+	if !underLoadFactor(hm.count, hm.slotCount()) {
+		B++
+	}
+	hm.rehash(B, &e)
+}
+
+// 重新生成种子，用新的b重建，extra为额外需要插入的元素
+// 重建中再次出现环，则容量翻倍重试
+func (hm *hmap) rehash(B uint8, extra *slot) {
+	entries := make([]slot, 0, hm.count+1)
+	for i := range hm.buckets {
+		for _, s := range hm.buckets[i].slots {
+			if s.used {
+				entries = append(entries, s)
+			}
+		}
+	}
+	if extra != nil {
+		entries = append(entries, *extra)
+	}
+	for {
+		hm.reseed()
+		hm.b = B
+		hm.buckets = make([]bucket, 1<<B)
+		ok := true
+		for _, e := range entries {
+			e.hash = hm.hash(e.key)
+			if _, ok = hm.insert(e); !ok {
+				break
+			}
+		}
+		if ok {
+			return
+		}
+		B++
+	}
+}
+
+// 生成新的种子
+func (hm *hmap) reseed() {
+	hm.seeds = [2]maphash.Seed{maphash.MakeSeed(), maphash.MakeSeed()}
+	hm.mapHash = newMapHashes(hm.seeds)
+}
+
+// 槽位的个数
+func (hm *hmap) slotCount() uint {
+	return uint(len(hm.buckets)) * bucketSize
+}
+
+// 是否满足扩容条件
+// 如果装载因子超过0.9，则返回true
+func overLoadFactor(count uint, slotCount uint) bool {
+	return count > slotCount*9/10
+}
+
+// 装载因子是否低于0.5
+func underLoadFactor(count uint, slotCount uint) bool {
+	return count < slotCount/2
+}
+
+func makemap(cap uint) *hmap {
+	h := new(hmap)
+	h.cap = cap
+	B := uint8(0)
+	for overLoadFactor(cap, bucketSize<<B) {
+		B++
+	}
+	h.b = B
+	h.buckets = make([]bucket, 1<<B)
+	h.reseed()
+	return h
+}
+
+type slot struct {
+	used bool
+	hash [2]uint64 // 两个hash值，踢出时不用重新计算
+	key  string
+	val  interface{}
+}
+
+type bucket struct {
+	slots [bucketSize]slot
+}
+
+// 从桶中找一个空闲处
+func (bk *bucket) getFree() (int, bool) {
+	for i := 0; i < bucketSize; i++ {
+		if !bk.slots[i].used {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// 计算桶的位置，也就是hash值的低b位
+func calbucket(hash uint64, b uint8) uint64 {
+	return hash & (1<<(b) - 1)
+}
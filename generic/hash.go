@@ -0,0 +1,30 @@
+package generic
+
+import (
+	"hash/maphash"
+)
+
+// 对应v2中的Hash，key可以是任意可比较类型
+type Hasher[K comparable] interface {
+	Seed() maphash.Seed
+	Hash(K) uint64
+}
+
+type mapHash[K comparable] struct {
+	seed maphash.Seed
+}
+
+func newMapHash[K comparable](seed maphash.Seed) *mapHash[K] {
+	return &mapHash[K]{
+		seed: seed,
+	}
+}
+
+func (hash *mapHash[K]) Seed() maphash.Seed {
+	return hash.seed
+}
+
+// int，结构体，数组等类型直接按内存哈希，不需要装箱，不分配内存
+func (hash *mapHash[K]) Hash(key K) uint64 {
+	return maphash.Comparable(hash.seed, key)
+}
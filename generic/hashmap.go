@@ -0,0 +1,418 @@
+package generic
+
+import (
+	"hash/maphash"
+)
+
+type Map[K comparable, V any] struct {
+	count              uint          // map内所有元素个数
+	b                  uint8         // 当前设置2^b为正常桶的个数
+	bucketCount        uint          // 桶的数量
+	buckets            []*bmap[K, V] // 正常桶
+	overflowBuckets    []*bmap[K, V] // 溢出桶
+	oldBuckets         []*bmap[K, V] // 正常桶，扩容时使用
+	oldOverflowBuckets []*bmap[K, V] // 溢出桶，扩容时使用
+	nevacuate          uint          // 迁移进度，小于nevacuate的旧桶都已迁移完成
+	sameSizeGrow       bool          // 当前是否为等量扩容
+	cap                uint          // 初始化时，预设的map容量
+	mapHash            Hasher[K]     //hash函数
+	seed               maphash.Seed  // 类似于hash0
+	noverflow          uint16        // 大致的溢出桶个数
+}
+
+func NewMap[K comparable, V any](cap int) *Map[K, V] {
+	seed := maphash.MakeSeed()
+	return NewMapWithHasher[K, V](cap, newMapHash[K](seed))
+}
+
+// 使用自定义的hash函数
+func NewMapWithHasher[K comparable, V any](cap int, hasher Hasher[K]) *Map[K, V] {
+	if cap < 0 || cap > 1<<30 {
+		panic("cap error")
+	}
+	if hasher == nil {
+		panic("hasher error")
+	}
+	return makemap[K, V](uint(cap), hasher)
+}
+
+func (m *Map[K, V]) Set(key K, val V) {
+	if m.set(key, val) {
+		m.count++
+	}
+}
+func (m *Map[K, V]) Get(key K) (V, bool) {
+	return m.get(key)
+}
+func (m *Map[K, V]) Delete(key K) {
+	if m.del(key) {
+		m.count--
+	}
+}
+func (m *Map[K, V]) Count() int {
+	return int(m.count)
+}
+
+// 返回值表示是否属于新增
+func (m *Map[K, V]) set(key K, val V) bool {
+	if m.buckets == nil {
+		m.buckets = bmapSliceMake[K, V](m.b)
+	}
+	hash := m.mapHash.Hash(key)
+
+again:
+	bucketIndex := calbucket(hash, m.b)
+	if m.growing() {
+		m.growWork(bucketIndex)
+	}
+	bm := m.buckets[bucketIndex]
+	// 先从正常桶和溢出桶查找
+	// 如果找到了，就直接更新
+	bucket, index, ok := bm.getIndex(key, hash)
+	if ok {
+		bucket.vals[index] = val
+		return false
+	}
+
+	// 新增元素前判断是否需要扩容，扩容中不再触发新的扩容
+	// 扩容后桶的位置可能变化，需要重新计算
+	if !m.growing() && m.testhashGrow() {
+		m.hashGrow()
+		goto again
+	}
+
+	m.insert(bm, key, val, hash)
+	return true
+}
+func (m *Map[K, V]) get(key K) (V, bool) {
+	if m.buckets == nil {
+		var zero V
+		return zero, false
+	}
+	hash := m.mapHash.Hash(key)
+	return m.bucket(hash).get(key, hash)
+}
+func (m *Map[K, V]) del(key K) bool {
+	if m.buckets == nil {
+		return false
+	}
+	hash := m.mapHash.Hash(key)
+	bucketIndex := calbucket(hash, m.b)
+	if m.growing() {
+		m.growWork(bucketIndex)
+	}
+	bucket := m.buckets[bucketIndex]
+	return bucket.del(key, hash)
+}
+
+// 查找hash所在的正常桶
+// 扩容中，如果对应的旧桶还未迁移，则返回旧桶
+func (m *Map[K, V]) bucket(hash uint64) *bmap[K, V] {
+	if m.growing() {
+		oldbm := m.oldBuckets[hash&m.oldbucketmask()]
+		if oldbm != nil {
+			return oldbm
+		}
+	}
+	return m.buckets[calbucket(hash, m.b)]
+}
+
+// 将key，val插入正常桶bm或其溢出桶的空闲处
+// 如果都满了，就创建一个新的溢出桶
+func (m *Map[K, V]) insert(bm *bmap[K, V], key K, val V, hash uint64) {
+	// 先从正常桶插入
+	b := bm
+	index, ok := bmapGetFree(b)
+	if ok {
+		b.update(index, key, val, hash)
+		b.count++
+		return
+	}
+	// 再找溢出桶
+	pre := b
+	overflow := b.overflow
+	for overflow != nil {
+		index, ok = bmapGetFree(overflow)
+		if ok {
+			overflow.update(index, key, val, hash)
+			overflow.count++
+			return
+		}
+		pre = overflow
+		overflow = overflow.overflow
+	}
+
+	// 如果溢出桶也满了，就创建一个新的溢出桶
+	overflow = new(bmap[K, V])
+
+	overflow.update(0, key, val, hash)
+	overflow.count++
+	pre.overflow = overflow
+	m.overflowBuckets = append(m.overflowBuckets, overflow)
+	m.incrnoverflow()
+}
+
+// 开始扩容，只分配新桶，不迁移数据
+// 旧桶在之后的Set，Delete中逐步迁移，见growWork
+func (m *Map[K, V]) hashGrow() {
+	B := m.b
+	m.sameSizeGrow = !overLoadFactor(m.count+1, m.bucketCount)
+	if !m.sameSizeGrow {
+		// 翻倍扩容
+		B++
+	}
+	m.oldBuckets = m.buckets
+	m.oldOverflowBuckets = m.overflowBuckets
+	m.buckets = bmapSliceMake[K, V](B)
+	m.overflowBuckets = make([]*bmap[K, V], 0)
+	m.noverflow = 0
+	m.nevacuate = 0
+	m.b = B
+	m.bucketCount = 1 << B
+}
+
+// 是否正在扩容
+func (m *Map[K, V]) growing() bool {
+	return m.oldBuckets != nil
+}
+
+// 旧桶的个数
+func (m *Map[K, V]) noldbuckets() uint {
+	return uint(len(m.oldBuckets))
+}
+
+// 旧桶的掩码，hash&oldbucketmask即旧桶的位置
+func (m *Map[K, V]) oldbucketmask() uint64 {
+	return uint64(m.noldbuckets() - 1)
+}
+
+// 每次Set，Delete最多迁移两个旧桶
+func (m *Map[K, V]) growWork(bucketIndex uint64) {
+	m.evacuate(uint(bucketIndex & m.oldbucketmask()))
+	if m.growing() {
+		m.evacuate(m.nevacuate)
+	}
+}
+
+// 迁移旧桶oldbucket及其溢出桶
+// 迁移完成后旧桶置为nil，Get时不再访问
+func (m *Map[K, V]) evacuate(oldbucket uint) {
+	oldbm := m.oldBuckets[oldbucket]
+	if oldbm != nil {
+		newbit := m.noldbuckets()
+		for ; oldbm != nil; oldbm = oldbm.overflow {
+			for j := uint8(0); j < 8; j++ {
+				if bmapEmpty(oldbm, j) {
+					continue
+				}
+				dst := oldbucket
+				// 翻倍扩容时，由旧桶个数对应的那一位决定分流
+				if !m.sameSizeGrow && oldbm.keyhash[j]&uint64(newbit) != 0 {
+					dst += newbit
+				}
+				m.insert(m.buckets[dst], oldbm.keys[j], oldbm.vals[j], oldbm.keyhash[j])
+			}
+		}
+		m.oldBuckets[oldbucket] = nil
+	}
+	if oldbucket == m.nevacuate {
+		m.advanceEvacuationMark()
+	}
+}
+
+// 推进迁移进度，全部迁移完成后释放旧桶，结束扩容
+func (m *Map[K, V]) advanceEvacuationMark() {
+	m.nevacuate++
+	for m.nevacuate < m.noldbuckets() && m.oldBuckets[m.nevacuate] == nil {
+		m.nevacuate++
+	}
+	if m.nevacuate == m.noldbuckets() {
+		m.oldBuckets = nil
+		m.oldOverflowBuckets = nil
+		m.sameSizeGrow = false
+	}
+}
+
+func (m *Map[K, V]) incrnoverflow() {
+	m.noverflow++
+}
+
+// 是否满足扩容条件
+func (m *Map[K, V]) testhashGrow() bool {
+	return overLoadFactor(m.count+1, m.bucketCount) || testTooManyBuckets(m.noverflow, m.b)
+}
+
+// 是否满足翻倍扩容条件
+// 如果装载因子超过6.5，则返回true
+func overLoadFactor(count uint, bucketCount uint) bool {
+	return count > bucketCount*13/2
+}
+
+// 是否满足等量扩容条件
+// 如果b>15，返回noverflow>=1<<15
+// 如果b<=15，返回noverflow>=1<<b
+func testTooManyBuckets(noverflow uint16, b uint8) bool {
+	if b > 15 {
+		b = 15
+	}
+	return noverflow >= uint16(1)<<(b&15)
+}
+
+func makemap[K comparable, V any](cap uint, hasher Hasher[K]) *Map[K, V] {
+	m := new(Map[K, V])
+	m.cap = cap
+	B := uint8(0)
+	for overloadFactor(cap, B) {
+		B++
+	}
+	m.b = B
+	// b为0时，第一次Set再分配
+	if m.b > 0 {
+		m.buckets = bmapSliceMake[K, V](B)
+	}
+	m.overflowBuckets = make([]*bmap[K, V], 0)
+	m.bucketCount = 1 << B
+	m.mapHash = hasher
+	m.seed = hasher.Seed()
+	return m
+}
+
+// tophash中除了哈希值的高八位，还记录槽位的状态，与v2相同
+// 小于minTopHash的值表示状态，哈希值的高八位小于minTopHash时加上minTopHash
+const (
+	emptyRest  = 0 // 槽位为空，且之后的槽位和溢出桶都为空
+	emptyOne   = 1 // 槽位为空
+	minTopHash = 5 // 正常的tophash最小值
+)
+
+// key，val直接按类型存储，不再使用interface{}
+type bmap[K comparable, V any] struct {
+	count    uint8 // 有效元素个数
+	tophash  [8]uint8
+	keyhash  [8]uint64
+	keys     [8]K
+	vals     [8]V
+	overflow *bmap[K, V]
+}
+
+func (bm *bmap[K, V]) get(key K, hash uint64) (V, bool) {
+	b, index, ok := bm.getIndex(key, hash)
+	if ok {
+		return b.vals[index], true
+	}
+	var zero V
+	return zero, false
+}
+
+// bm为正常桶
+// 删除后如果之后的槽位都为空，则向前将连续的emptyOne改为emptyRest，查找时可以提前结束
+func (bm *bmap[K, V]) del(key K, hash uint64) bool {
+	b, index, ok := bm.getIndex(key, hash)
+	if !ok {
+		return false
+	}
+	var k K
+	var v V
+	b.update(index, k, v, 0)
+	b.tophash[index] = emptyOne
+	b.count--
+
+	if index == 7 {
+		if b.overflow != nil && b.overflow.tophash[0] != emptyRest {
+			return true
+		}
+	} else if b.tophash[index+1] != emptyRest {
+		return true
+	}
+	for {
+		b.tophash[index] = emptyRest
+		if index == 0 {
+			if b == bm {
+				break
+			}
+			// 找到前一个桶
+			c := b
+			for b = bm; b.overflow != c; b = b.overflow {
+			}
+			index = 7
+		} else {
+			index--
+		}
+		if b.tophash[index] != emptyOne {
+			break
+		}
+	}
+	return true
+}
+
+// 通过遍历正常桶与溢出桶查找
+// 遇到emptyRest说明之后都为空，提前结束
+func (bm *bmap[K, V]) getIndex(key K, hash uint64) (*bmap[K, V], uint8, bool) {
+	tophash := calTopHash(hash)
+	for b := bm; b != nil; b = b.overflow {
+		for i := uint8(0); i < 8; i++ {
+			if b.tophash[i] != tophash {
+				if b.tophash[i] == emptyRest {
+					return nil, uint8(0), false
+				}
+				continue
+			}
+			if hash == b.keyhash[i] && key == b.keys[i] {
+				return b, i, true
+			}
+		}
+	}
+	return nil, uint8(0), false
+}
+func (bm *bmap[K, V]) update(index uint8, key K, val V, hash uint64) {
+	bm.tophash[index] = calTopHash(hash)
+	bm.keyhash[index] = hash
+	bm.keys[index] = key
+	bm.vals[index] = val
+}
+
+// 从桶中找一个空闲处
+func bmapGetFree[K comparable, V any](bm *bmap[K, V]) (uint8, bool) {
+	if bm.count == 8 {
+		return uint8(0), false
+	}
+	for i := uint8(0); i < 8; i++ {
+		if bmapEmpty(bm, i) {
+			return i, true
+		}
+	}
+	return uint8(0), false
+}
+
+// 判断index是否为空
+func bmapEmpty[K comparable, V any](bm *bmap[K, V], index uint8) bool {
+	return bm.tophash[index] <= emptyOne
+}
+
+func bmapSliceMake[K comparable, V any](b uint8) []*bmap[K, V] {
+	s := make([]*bmap[K, V], 1<<b)
+	for i := 0; i < 1<<b; i++ {
+		s[i] = new(bmap[K, V])
+	}
+	return s
+}
+
+// 计算cap是否大于2^b
+func overloadFactor(cap uint, b uint8) bool {
+	return cap > 1<<(b+3)
+}
+
+// 计算桶的位置，也就是hash值的低b位
+func calbucket(hash uint64, b uint8) uint64 {
+	return hash & (1<<(b) - 1)
+}
+
+// 计算tophash，也就是hash值的高八位
+// 小于minTopHash的值用于表示状态，需要跳过
+func calTopHash(hash uint64) uint8 {
+	top := uint8(hash >> 56)
+	if top < minTopHash {
+		top += minTopHash
+	}
+	return top
+}
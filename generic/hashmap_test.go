@@ -0,0 +1,185 @@
+package generic
+
+import (
+	"hash/maphash"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 初始化Map，cap为负数
+func TestNewMap1(t *testing.T) {
+	assert := assert.New(t)
+	table := []struct {
+		cap   int
+		panic bool
+	}{
+		{1, false},
+		{0, false},
+		{-1, true},
+	}
+	for _, v := range table {
+		fc := func() {
+			NewMap[string, int](v.cap)
+		}
+		if v.panic {
+			assert.Panics(fc, v.cap)
+		} else {
+			assert.NotPanics(fc, v.cap)
+		}
+	}
+}
+
+// 测试Map.b
+func TestNewMap2(t *testing.T) {
+	assert := assert.New(t)
+	table := []struct {
+		cap         int
+		b           uint8
+		bucketCount uint
+	}{
+		{0, 0, 1 << 0},
+		{1 << 0, 0, 1 << 0},
+		{1<<4 - 1, 1, 1 << 1},
+		{1 << 10, 7, 1 << 7},
+		{1<<10 + 1, 8, 1 << 8},
+	}
+	for _, v := range table {
+		m := NewMap[int, int](v.cap)
+		assert.Equal(v.b, m.b, v.cap)
+		assert.Equal(v.bucketCount, m.bucketCount, v.cap)
+	}
+}
+
+// 测试string key
+func TestSetGetString(t *testing.T) {
+	assert := assert.New(t)
+	m := NewMap[string, int](0)
+	count := 1 << 12
+	for i := 0; i < count; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	assert.Equal(count, m.Count())
+	for i := 0; i < count; i++ {
+		val, ok := m.Get(strconv.Itoa(i))
+		assert.True(ok, i)
+		assert.Equal(i, val, i)
+	}
+	_, ok := m.Get("-1")
+	assert.False(ok)
+}
+
+// 测试int，结构体，数组key
+func TestSetGetKeys(t *testing.T) {
+	type point struct {
+		X, Y int
+	}
+	assert := assert.New(t)
+	count := 1 << 12
+
+	mi := NewMap[int, string](0)
+	mp := NewMap[point, int](0)
+	ma := NewMap[[4]byte, int](0)
+	for i := 0; i < count; i++ {
+		mi.Set(i, strconv.Itoa(i))
+		mp.Set(point{i, -i}, i)
+		ma.Set([4]byte{byte(i), byte(i >> 8)}, i)
+	}
+	for i := 0; i < count; i++ {
+		s, ok := mi.Get(i)
+		assert.True(ok, i)
+		assert.Equal(strconv.Itoa(i), s, i)
+		v, ok := mp.Get(point{i, -i})
+		assert.True(ok, i)
+		assert.Equal(i, v, i)
+		v, ok = ma.Get([4]byte{byte(i), byte(i >> 8)})
+		assert.True(ok, i)
+		assert.Equal(i, v, i)
+	}
+	_, ok := mp.Get(point{1, 1})
+	assert.False(ok)
+}
+
+// 测试重复Set与Delete
+func TestSetDelete(t *testing.T) {
+	assert := assert.New(t)
+	m := NewMap[int, int](100)
+	count := 1 << 12
+	for i := 0; i < count; i++ {
+		m.Set(i, i)
+		m.Set(i, i*2)
+	}
+	assert.Equal(count, m.Count())
+	for i := 0; i < count; i += 2 {
+		m.Delete(i)
+	}
+	m.Delete(-1)
+	assert.Equal(count/2, m.Count())
+	for i := 0; i < count; i++ {
+		val, ok := m.Get(i)
+		if i%2 == 0 {
+			assert.False(ok, i)
+			assert.Equal(0, val, i)
+		} else {
+			assert.True(ok, i)
+			assert.Equal(i*2, val, i)
+		}
+	}
+}
+
+type constHasher struct {
+	seed maphash.Seed
+}
+
+func (h constHasher) Seed() maphash.Seed {
+	return h.seed
+}
+
+func (h constHasher) Hash(key int) uint64 {
+	return 0
+}
+
+// 测试自定义Hasher，所有key哈希冲突且哈希值为0
+func TestHasher(t *testing.T) {
+	assert := assert.New(t)
+	m := NewMapWithHasher[int, int](0, constHasher{maphash.MakeSeed()})
+	count := 100
+	for i := 0; i < count; i++ {
+		m.Set(i, i)
+	}
+	assert.Equal(count, m.Count())
+	for i := 0; i < count; i++ {
+		val, ok := m.Get(i)
+		assert.True(ok, i)
+		assert.Equal(i, val, i)
+	}
+	// 删除中间的元素后，之后溢出桶中的元素仍能找到
+	for i := 0; i < count/2; i++ {
+		m.Delete(i)
+	}
+	assert.Equal(count/2, m.Count())
+	for i := 0; i < count; i++ {
+		_, ok := m.Get(i)
+		assert.Equal(i >= count/2, ok, i)
+	}
+	assert.Panics(func() {
+		NewMapWithHasher[int, int](0, nil)
+	})
+}
+
+// 查询不分配内存
+func TestGetNoAlloc(t *testing.T) {
+	assert := assert.New(t)
+	type point struct {
+		X, Y int
+	}
+	m := NewMap[point, int](100)
+	for i := 0; i < 100; i++ {
+		m.Set(point{i, i}, i)
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		m.Get(point{50, 50})
+	})
+	assert.Equal(float64(0), allocs)
+}
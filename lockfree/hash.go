@@ -0,0 +1,30 @@
+package lockfree
+
+import (
+	"hash/maphash"
+)
+
+type Hash interface {
+	Seed() maphash.Seed
+	Hash(string) uint64
+}
+
+// 不保存maphash.Hash的状态，可以并发调用
+type mapHash struct {
+	seed maphash.Seed
+}
+
+func newMapHash(seed maphash.Seed) *mapHash {
+	mh := &mapHash{
+		seed: seed,
+	}
+	return mh
+}
+
+func (hash *mapHash) Seed() maphash.Seed {
+	return hash.seed
+}
+
+func (hash *mapHash) Hash(key string) uint64 {
+	return maphash.String(hash.seed, key)
+}
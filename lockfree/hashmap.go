@@ -0,0 +1,269 @@
+package lockfree
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"sync/atomic"
+)
+
+const (
+	loadFactor = 4  // 平均每个桶的元素个数超过loadFactor时，桶的个数翻倍
+	maxB       = 32 // 最多2^maxB个桶
+)
+
+// 无锁并发map，参考split-ordered list（Shalev，Shavit）
+// 所有元素按哈希值位反转后的顺序放在一个无锁有序链表中，每个桶指向链表中的一个哨兵节点
+// 桶的个数翻倍时不需要移动元素，只需要在链表中插入新的哨兵节点
+type hmap struct {
+	count    atomic.Int64                      // map内所有元素个数
+	b        atomic.Uint32                     // 当前设置2^b为桶的个数
+	segments [maxB + 1]atomic.Pointer[segment] // 桶按2的幂分段，段第一次使用时分配
+	cap      uint                              // 初始化时，预设的map容量
+	mapHash  Hash                              //hash函数
+	seed     maphash.Seed                      // 类似于hash0
+}
+
+// 第0段只有桶0，第i段有桶[2^(i-1), 2^i)
+type segment []atomic.Pointer[node]
+
+type node struct {
+	sokey uint64                      // 位反转后的哈希值，哨兵节点最低位为0，普通节点最低位为1
+	key   string                      // 哨兵节点为空
+	val   atomic.Pointer[interface{}] // 哨兵节点为nil
+	next  atomic.Pointer[markedRef]
+}
+
+// 下一个节点和删除标记，一起原子替换
+type markedRef struct {
+	node   *node
+	marked bool // 当前节点是否已被删除
+}
+
+func NewHMap(cap int) *hmap {
+	if cap < 0 || cap > 1<<30 {
+		panic("cap error")
+	}
+	return makemap(uint(cap))
+}
+
+// Set通过CAS插入或更新
+func (hm *hmap) Set(key string, val interface{}) {
+	hash := hm.mapHash.Hash(key)
+	head := hm.bucket(hash)
+	if _, ok := hm.insert(head, regularKey(hash), key, &val); ok {
+		hm.count.Add(1)
+		hm.testhashGrow()
+	}
+}
+
+// Get不加锁，也不修改已有的节点，只在桶第一次使用时通过CAS插入哨兵节点
+func (hm *hmap) Get(key string) (interface{}, bool) {
+	hash := hm.mapHash.Hash(key)
+	sokey := regularKey(hash)
+	curr := hm.bucket(hash).next.Load().node
+	for curr != nil {
+		ref := curr.next.Load()
+		// 跳过已标记删除的节点
+		if !ref.marked && !less(curr, sokey, key) {
+			if curr.sokey == sokey && curr.key == key {
+				return *curr.val.Load(), true
+			}
+			return nil, false
+		}
+		curr = ref.node
+	}
+	return nil, false
+}
+
+// Delete先标记节点，再通过CAS从链表中移除
+func (hm *hmap) Delete(key string) {
+	hash := hm.mapHash.Hash(key)
+	head := hm.bucket(hash)
+	sokey := regularKey(hash)
+	for {
+		pred, predRef, curr, ok := find(head, sokey, key)
+		if !ok {
+			return
+		}
+		ref := curr.next.Load()
+		if ref.marked {
+			continue
+		}
+		if !curr.next.CompareAndSwap(ref, &markedRef{node: ref.node, marked: true}) {
+			continue
+		}
+		hm.count.Add(-1)
+		// 移除失败也没关系，之后的find会移除
+		pred.next.CompareAndSwap(predRef, &markedRef{node: ref.node})
+		return
+	}
+}
+
+func (hm *hmap) Count() int {
+	return int(hm.count.Load())
+}
+
+// 按链表顺序遍历所有元素，f返回false时停止
+// 遍历中的修改不保证能遍历到
+func (hm *hmap) Range(f func(key string, val interface{}) bool) {
+	curr := hm.bucketAt(0).next.Load().node
+	for curr != nil {
+		ref := curr.next.Load()
+		if !ref.marked && curr.sokey&1 == 1 {
+			if !f(curr.key, *curr.val.Load()) {
+				return
+			}
+		}
+		curr = ref.node
+	}
+}
+
+// 在以head开始的链表中插入普通节点或哨兵节点
+// 已存在则更新val，返回已存在的节点和false
+func (hm *hmap) insert(head *node, sokey uint64, key string, val *interface{}) (*node, bool) {
+	n := &node{sokey: sokey, key: key}
+	n.val.Store(val)
+	for {
+		pred, predRef, curr, ok := find(head, sokey, key)
+		if ok {
+			if val != nil {
+				curr.val.Store(val)
+			}
+			return curr, false
+		}
+		n.next.Store(&markedRef{node: curr})
+		if pred.next.CompareAndSwap(predRef, &markedRef{node: n}) {
+			return n, true
+		}
+	}
+}
+
+// 从head开始查找第一个不小于(sokey，key)的节点，返回它和它的前一个节点
+// 遇到已标记删除的节点，顺便从链表中移除
+func find(head *node, sokey uint64, key string) (*node, *markedRef, *node, bool) {
+retry:
+	pred := head
+	predRef := pred.next.Load()
+	curr := predRef.node
+	for curr != nil {
+		ref := curr.next.Load()
+		if ref.marked {
+			newRef := &markedRef{node: ref.node}
+			if !pred.next.CompareAndSwap(predRef, newRef) {
+				goto retry
+			}
+			predRef = newRef
+			curr = ref.node
+			continue
+		}
+		if !less(curr, sokey, key) {
+			return pred, predRef, curr, curr.sokey == sokey && curr.key == key
+		}
+		pred = curr
+		predRef = ref
+		curr = ref.node
+	}
+	return pred, predRef, nil, false
+}
+
+// 节点n是否排在(sokey，key)之前
+// sokey相同时，说明哈希值相同，再按key排序
+func less(n *node, sokey uint64, key string) bool {
+	if n.sokey != sokey {
+		return n.sokey < sokey
+	}
+	return n.key < key
+}
+
+// 元素个数超过装载因子时，桶的个数翻倍
+// 只需要修改b，新的桶在第一次使用时初始化
+func (hm *hmap) testhashGrow() {
+	b := hm.b.Load()
+	if b < maxB && overLoadFactor(hm.count.Load(), b) {
+		hm.b.CompareAndSwap(b, b+1)
+	}
+}
+
+// 返回hash所在桶的哨兵节点，桶未初始化则先初始化
+func (hm *hmap) bucket(hash uint64) *node {
+	return hm.bucketAt(calbucket(hash, uint8(hm.b.Load())))
+}
+
+// 返回桶index的哨兵节点，桶未初始化则先初始化
+func (hm *hmap) bucketAt(index uint64) *node {
+	seg, offset := calsegment(index)
+	s := hm.segments[seg].Load()
+	if s == nil {
+		newSeg := make(segment, segmentSize(seg))
+		if !hm.segments[seg].CompareAndSwap(nil, &newSeg) {
+			s = hm.segments[seg].Load()
+		} else {
+			s = &newSeg
+		}
+	}
+	if head := (*s)[offset].Load(); head != nil {
+		return head
+	}
+	// 从父桶开始插入哨兵节点，父桶为index去掉最高位的1
+	parent := hm.bucketAt(index &^ (1 << (bits.Len64(index) - 1)))
+	head, _ := hm.insert(parent, dummyKey(index), "", nil)
+	(*s)[offset].CompareAndSwap(nil, head)
+	return head
+}
+
+// 是否满足扩容条件
+// 如果平均每个桶的元素个数超过loadFactor，则返回true
+func overLoadFactor(count int64, b uint32) bool {
+	return count > loadFactor<<b
+}
+
+func makemap(cap uint) *hmap {
+	h := new(hmap)
+	h.cap = cap
+	B := uint32(0)
+	for overLoadFactor(int64(cap), B) {
+		B++
+	}
+	h.b.Store(B)
+	h.seed = maphash.MakeSeed()
+	h.mapHash = newMapHash(h.seed)
+	// 桶0的哨兵节点是整个链表的头
+	head := &node{}
+	head.next.Store(&markedRef{})
+	seg := make(segment, 1)
+	seg[0].Store(head)
+	h.segments[0].Store(&seg)
+	return h
+}
+
+// 桶index所在的段和段内位置
+func calsegment(index uint64) (int, uint64) {
+	seg := bits.Len64(index)
+	if seg == 0 {
+		return 0, 0
+	}
+	return seg, index - 1<<(seg-1)
+}
+
+// 第seg段的桶个数
+func segmentSize(seg int) int {
+	if seg == 0 {
+		return 1
+	}
+	return 1 << (seg - 1)
+}
+
+// 普通节点的排序key，最高位置1后位反转，最低位一定为1
+func regularKey(hash uint64) uint64 {
+	return bits.Reverse64(hash | 1<<63)
+}
+
+// 哨兵节点的排序key，位反转后最低位一定为0
+func dummyKey(index uint64) uint64 {
+	return bits.Reverse64(index)
+}
+
+// 计算桶的位置，也就是hash值的低b位
+func calbucket(hash uint64, b uint8) uint64 {
+	return hash & (1<<(b) - 1)
+}
@@ -0,0 +1,120 @@
+package lockfree
+
+import (
+	"math/rand"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 压力测试，建议使用go test -race运行
+// 每个goroutine操作自己的一组key，结果与本地map对比
+// 同时所有goroutine争抢一组共享的key
+func TestStress(t *testing.T) {
+	assert := assert.New(t)
+	workers := runtime.GOMAXPROCS(0) * 2
+	ops := 1 << 15
+	if testing.Short() {
+		ops = 1 << 12
+	}
+	keys := 1 << 10
+	shared := 16
+
+	m := NewHMap(0)
+	models := make([]map[string]int, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(w)))
+			model := make(map[string]int)
+			for i := 0; i < ops; i++ {
+				key := strconv.Itoa(w) + "-" + strconv.Itoa(r.Intn(keys))
+				switch r.Intn(4) {
+				case 0, 1:
+					m.Set(key, i)
+					model[key] = i
+				case 2:
+					m.Delete(key)
+					delete(model, key)
+				case 3:
+					val, ok := m.Get(key)
+					want, exists := model[key]
+					assert.Equal(exists, ok, key)
+					if exists {
+						assert.Equal(want, val, key)
+					}
+				}
+				// 共享的key，只检查值的格式
+				skey := "shared-" + strconv.Itoa(r.Intn(shared))
+				switch r.Intn(3) {
+				case 0:
+					m.Set(skey, skey)
+				case 1:
+					m.Delete(skey)
+				case 2:
+					if val, ok := m.Get(skey); ok {
+						assert.Equal(skey, val)
+					}
+				}
+			}
+			models[w] = model
+		}(w)
+	}
+	wg.Wait()
+
+	for i := 0; i < shared; i++ {
+		m.Delete("shared-" + strconv.Itoa(i))
+	}
+	count := 0
+	for _, model := range models {
+		count += len(model)
+		for key, want := range model {
+			val, ok := m.Get(key)
+			assert.True(ok, key)
+			assert.Equal(want, val, key)
+		}
+	}
+	assert.Equal(count, m.Count())
+	n := 0
+	m.Range(func(key string, val interface{}) bool {
+		n++
+		return true
+	})
+	assert.Equal(count, n)
+}
+
+// 压力测试，并发插入不同的key，同时触发桶的翻倍和初始化
+func TestStressGrow(t *testing.T) {
+	assert := assert.New(t)
+	workers := runtime.GOMAXPROCS(0) * 2
+	count := 1 << 13
+	if testing.Short() {
+		count = 1 << 10
+	}
+	m := NewHMap(0)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				key := strconv.Itoa(w*count + i)
+				m.Set(key, i)
+				_, ok := m.Get(key)
+				assert.True(ok, key)
+			}
+		}(w)
+	}
+	wg.Wait()
+	assert.Equal(workers*count, m.Count())
+	for i := 0; i < workers*count; i++ {
+		val, ok := m.Get(strconv.Itoa(i))
+		assert.True(ok, i)
+		assert.Equal(i%count, val, i)
+	}
+}
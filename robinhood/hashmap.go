@@ -0,0 +1,162 @@
+package robinhood
+
+import (
+	"hash/maphash"
+)
+
+type hmap struct {
+	count   uint         // map内所有元素个数
+	b       uint8        // 当前设置2^b为槽位的个数
+	slots   []slot       // 所有槽位
+	cap     uint         // 初始化时，预设的map容量
+	mapHash Hash         //hash函数
+	seed    maphash.Seed // 类似于hash0
+}
+
+func NewHMap(cap int) *hmap {
+	if cap < 0 || cap > 1<<30 {
+		panic("cap error")
+	}
+	return makemap(uint(cap))
+}
+
+func (hm *hmap) Set(key string, val interface{}) {
+	if hm.set(key, val) {
+		hm.count++
+	}
+}
+func (hm *hmap) Get(key string) (interface{}, bool) {
+	return hm.get(key)
+}
+func (hm *hmap) Delete(key string) {
+	if hm.del(key) {
+		hm.count--
+	}
+}
+func (hm *hmap) Count() int {
+	return int(hm.count)
+}
+
+// 返回值表示是否属于新增
+func (hm *hmap) set(key string, val interface{}) bool {
+	hash := hm.mapHash.Hash(key)
+	index, ok := hm.find(key, hash)
+	if ok {
+		hm.slots[index].val = val
+		return false
+	}
+	// 新增元素前判断是否需要扩容
+	if overLoadFactor(hm.count+1, uint(len(hm.slots))) {
+		hm.grow()
+	}
+	hm.insert(slot{dist: 1, hash: hash, key: key, val: val})
+	return true
+}
+func (hm *hmap) get(key string) (interface{}, bool) {
+	index, ok := hm.find(key, hm.mapHash.Hash(key))
+	if ok {
+		return hm.slots[index].val, true
+	}
+	return nil, false
+}
+
+// 向后移位删除，不使用墓碑
+// 将之后探测距离大于1的元素依次前移一位，直到遇到空槽位或者在原位置的元素
+func (hm *hmap) del(key string) bool {
+	index, ok := hm.find(key, hm.mapHash.Hash(key))
+	if !ok {
+		return false
+	}
+	mask := hm.slotmask()
+	next := (index + 1) & mask
+	for hm.slots[next].dist > 1 {
+		hm.slots[index] = hm.slots[next]
+		hm.slots[index].dist--
+		index = next
+		next = (next + 1) & mask
+	}
+	hm.slots[index] = slot{}
+	return true
+}
+
+// 从hash的位置开始线性探测
+// 遇到空槽位，或者槽位中元素的探测距离比当前的小，说明key不存在
+func (hm *hmap) find(key string, hash uint64) (uint64, bool) {
+	mask := hm.slotmask()
+	index := hash & mask
+	for dist := uint32(1); ; dist++ {
+		s := &hm.slots[index]
+		if s.dist < dist {
+			return 0, false
+		}
+		if s.hash == hash && s.key == key {
+			return index, true
+		}
+		index = (index + 1) & mask
+	}
+}
+
+// 插入一个不存在的元素
+// 遇到探测距离比自己小的元素，交换后继续为被交换的元素找位置
+func (hm *hmap) insert(e slot) {
+	mask := hm.slotmask()
+	index := e.hash & mask
+	for {
+		s := &hm.slots[index]
+		if s.dist == 0 {
+			*s = e
+			return
+		}
+		if s.dist < e.dist {
+			*s, e = e, *s
+		}
+		e.dist++
+		index = (index + 1) & mask
+	}
+}
+
+// 翻倍扩容，一次性分配
+func (hm *hmap) grow() {
+	oldslots := hm.slots
+	hm.b++
+	hm.slots = make([]slot, 1<<hm.b)
+	for _, s := range oldslots {
+		if s.dist != 0 {
+			s.dist = 1
+			hm.insert(s)
+		}
+	}
+}
+
+// 槽位的掩码
+func (hm *hmap) slotmask() uint64 {
+	return uint64(len(hm.slots) - 1)
+}
+
+// 是否满足扩容条件
+// 如果装载因子超过0.9，则返回true
+func overLoadFactor(count uint, slotCount uint) bool {
+	return count > slotCount*9/10
+}
+
+func makemap(cap uint) *hmap {
+	h := new(hmap)
+	h.cap = cap
+	B := uint8(0)
+	for overLoadFactor(cap, 1<<B) {
+		B++
+	}
+	h.b = B
+	h.slots = make([]slot, 1<<B)
+	h.seed = maphash.MakeSeed()
+	hash := newMapHash(h.seed)
+	h.mapHash = hash
+	return h
+}
+
+type slot struct {
+	dist uint32 // 探测距离+1，0表示空槽位
+	hash uint64
+	key  string
+	val  interface{}
+}
@@ -0,0 +1,342 @@
+package robinhood
+
+import (
+	"hash/maphash"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 初始化HMap，cap为负数
+func TestNewHMap1(t *testing.T) {
+	assert := assert.New(t)
+	table := []struct {
+		cap   int
+		panic bool
+	}{
+		{1, false},
+		{0, false},
+		{-1, true},
+	}
+	for _, v := range table {
+
+		fc := func() {
+			NewHMap(v.cap)
+		}
+		if v.panic {
+			assert.Panics(fc, v.cap)
+		}
+	}
+}
+
+// 测试槽位的个数
+func TestNewHMap2(t *testing.T) {
+	assert := assert.New(t)
+	table := []struct {
+		cap   int
+		b     uint8
+		slots int
+	}{
+		{0, 0, 1 << 0},
+		{1 << 0, 1, 1 << 1},
+		{9, 4, 1 << 4},
+		{1<<10 - 1, 11, 1 << 11},
+		{921, 10, 1 << 10},
+		{922, 11, 1 << 11},
+	}
+	for _, v := range table {
+		m := NewHMap(v.cap)
+		assert.Equal(v.b, m.b, v.cap)
+		assert.Equal(v.slots, len(m.slots), v.cap)
+	}
+}
+
+// 测试Set，Get各种类型
+func TestSetGet1(t *testing.T) {
+	type user struct {
+		Name string
+		Age  int
+	}
+	assert := assert.New(t)
+	table := []struct {
+		key string
+		val interface{}
+	}{
+		{"a", 1},
+		{"a1", 2},
+		{"a2", 4},
+		{"a3", -8},
+		{"a4", "16"},
+		{"a5", "32"},
+		{"a6", 3.14},
+		{"a7", -3.14},
+		{"a8", true},
+		{"a9", false},
+		{"a10", 'a'},
+		{"a11", '\r'},
+		{"a12", "啊啊啊"},
+		{"a13", []int{1, 2, 3}},
+		{"a14", []string{"1", "2", "3"}},
+		{"a15", map[string]int{"ab": 1, "bed": 2}},
+		{"a16", map[string]string{"ab": "aaaa", "bed": "asdff"}},
+		{"a17", user{"wc", 88}},
+		{"a18", &user{"wc", 88}},
+	}
+	m := NewHMap(100)
+	for _, v := range table {
+		m.Set(v.key, v.val)
+	}
+	for _, v := range table {
+		val, ok := m.Get(v.key)
+		assert.True(ok, v.key)
+		assert.Equal(v.val, val, v.key)
+	}
+}
+
+// 测试 重复Set
+func TestSetGet2(t *testing.T) {
+	assert := assert.New(t)
+	table := []struct {
+		key    string
+		val    interface{}
+		exists bool
+	}{
+		{"a", 1, false},
+		{"a", 2, true},
+		{"a1", 3, false},
+		{"a1", 4, false},
+		{"a1", 5, true},
+	}
+	m := NewHMap(100)
+	for _, v := range table {
+		m.Set(v.key, v.val)
+	}
+	for _, v := range table {
+		val, ok := m.Get(v.key)
+		if v.exists {
+			assert.True(ok, v.key)
+			assert.Equal(v.val, val, v.key)
+		}
+	}
+}
+
+// 测试Count
+func TestCount1(t *testing.T) {
+	type user struct {
+		Name string
+		Age  int
+	}
+	assert := assert.New(t)
+	table := []struct {
+		key string
+		val interface{}
+	}{
+		{"a", 1},
+		{"a1", 2},
+		{"a2", 4},
+		{"a3", -8},
+		{"a4", "16"},
+		{"a5", "32"},
+		{"a6", 3.14},
+		{"a7", -3.14},
+		{"a8", true},
+		{"a9", false},
+		{"a10", 'a'},
+		{"a11", '\r'},
+		{"a12", "啊啊啊"},
+		{"a13", []int{1, 2, 3}},
+		{"a14", []string{"1", "2", "3"}},
+		{"a15", map[string]int{"ab": 1, "bed": 2}},
+		{"a16", map[string]string{"ab": "aaaa", "bed": "asdff"}},
+		{"a17", user{"wc", 88}},
+		{"a18", &user{"wc", 88}},
+	}
+	m := NewHMap(100)
+	for _, v := range table {
+		m.Set(v.key, v.val)
+	}
+	assert.Equal(len(table), m.Count())
+}
+
+// 测试Del
+func TestDel(t *testing.T) {
+	type user struct {
+		Name string
+		Age  int
+	}
+	assert := assert.New(t)
+	table := []struct {
+		key    string
+		val    interface{}
+		delete bool
+	}{
+		{"a", 1, false},
+		{"a1", 2, false},
+		{"a2", 4, false},
+		{"a3", -8, false},
+		{"a4", "16", false},
+		{"a5", "32", true},
+		{"a6", 3.14, false},
+		{"a7", -3.14, false},
+		{"a8", true, true},
+		{"a9", false, false},
+		{"a10", 'a', false},
+		{"a11", '\r', false},
+		{"a12", "啊啊啊", false},
+		{"a13", []int{1, 2, 3}, false},
+		{"a14", []string{"1", "2", "3"}, true},
+		{"a15", map[string]int{"ab": 1, "bed": 2}, true},
+		{"a16", map[string]string{"ab": "aaaa", "bed": "asdff"}, false},
+		{"a17", user{"wc", 88}, false},
+		{"a18", &user{"wc", 88}, true},
+	}
+	m := NewHMap(100)
+	for _, v := range table {
+		m.Set(v.key, v.val)
+	}
+	for _, v := range table {
+		if v.delete {
+			m.Delete(v.key)
+		}
+	}
+	for _, v := range table {
+		val, ok := m.Get(v.key)
+		if v.delete {
+			assert.False(ok, v.key)
+			assert.Nil(val, v.key)
+		} else {
+			assert.True(ok, v.key)
+			assert.Equal(v.val, val, v.key)
+		}
+	}
+}
+
+// 测试溢出
+func TestOverflow(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(1 << 4)
+	count := 1 << 15
+	for i := 0; i < count; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	// 防止hash值相等，被覆盖
+	if count == m.Count() {
+		for i := 0; i < count; i++ {
+			val, ok := m.Get(strconv.Itoa(i))
+			assert.True(ok)
+			assert.Equal(i, val, i)
+		}
+	}
+}
+
+// 哈希值固定，用于测试哈希冲突
+type fixedHash struct {
+	seed maphash.Seed
+	hash uint64
+}
+
+func (hash fixedHash) Seed() maphash.Seed {
+	return hash.seed
+}
+
+func (hash fixedHash) Hash(key string) uint64 {
+	return hash.hash
+}
+
+// 检查每个元素的探测距离与位置一致，且没有元素的位置比前一个元素早两位以上
+func checkSlots(assert *assert.Assertions, m *hmap) {
+	mask := m.slotmask()
+	count := 0
+	for i, s := range m.slots {
+		if s.dist == 0 {
+			continue
+		}
+		count++
+		assert.Equal(uint64(i), (s.hash+uint64(s.dist)-1)&mask, s.key)
+		prev := m.slots[(uint64(i)-1)&mask]
+		assert.LessOrEqual(s.dist, prev.dist+1, s.key)
+	}
+	assert.Equal(m.Count(), count)
+}
+
+// 测试装载因子不超过0.9
+func TestLoadFactor(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(0)
+	for i := 0; i < 1<<12; i++ {
+		m.Set(strconv.Itoa(i), i)
+		assert.LessOrEqual(m.Count()*10, len(m.slots)*9, i)
+	}
+	assert.Equal(uint8(13), m.b)
+	checkSlots(assert, m)
+}
+
+// 测试向后移位删除
+func TestBackwardShift(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(1 << 10)
+	m.mapHash = fixedHash{m.seed, 5}
+	for i := 0; i < 10; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	checkSlots(assert, m)
+	m.Delete("3")
+	// 之后的元素依次前移，没有墓碑
+	for i, key := range []string{"0", "1", "2", "4", "5", "6", "7", "8", "9"} {
+		s := m.slots[5+i]
+		assert.Equal(key, s.key)
+		assert.Equal(uint32(i+1), s.dist)
+	}
+	assert.Equal(uint32(0), m.slots[14].dist)
+	checkSlots(assert, m)
+}
+
+// 测试大量随机删除后，探测距离与位置仍一致
+func TestDeleteMany(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(0)
+	count := 1 << 12
+	for i := 0; i < count; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	for i := 0; i < count; i += 3 {
+		m.Delete(strconv.Itoa(i))
+	}
+	checkSlots(assert, m)
+	for i := 0; i < count; i++ {
+		val, ok := m.Get(strconv.Itoa(i))
+		if i%3 == 0 {
+			assert.False(ok, i)
+		} else {
+			assert.True(ok, i)
+			assert.Equal(i, val, i)
+		}
+	}
+}
+
+// 测试所有key哈希冲突，探测距离很长
+func TestLongDist(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(1 << 10)
+	m.mapHash = fixedHash{m.seed, 0}
+	count := 300
+	for i := 0; i < count; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	assert.Equal(uint8(11), m.b)
+	assert.Equal(uint32(count), m.slots[count-1].dist)
+	for i := 0; i < count; i += 2 {
+		m.Delete(strconv.Itoa(i))
+	}
+	checkSlots(assert, m)
+	for i := 0; i < count; i++ {
+		val, ok := m.Get(strconv.Itoa(i))
+		if i%2 == 0 {
+			assert.False(ok, i)
+		} else {
+			assert.True(ok, i)
+			assert.Equal(i, val, i)
+		}
+	}
+}
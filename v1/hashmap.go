@@ -157,7 +157,7 @@ func (bm *bmap) getIndex(key string, hash uint64) (*bmap, uint8, bool) {
 	}
 	// 从溢出桶搜索
 	overflow := b.overflow
-	for overflow != nil && overflow.count > 0 {
+	for overflow != nil {
 		index, ok := bmapSearch(overflow, key, hash)
 		if ok {
 			return overflow, index, true
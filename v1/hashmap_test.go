@@ -1,6 +1,7 @@
 package v1
 
 import (
+	"hash/maphash"
 	"strconv"
 	"testing"
 
@@ -240,3 +241,35 @@ func TestLoadFactor1(t *testing.T) {
 	}
 	assert.Equal(float32(8), m.loadFactor())
 }
+
+// 所有key哈希值相同，用于测试哈希冲突
+type collideHash struct {
+	seed maphash.Seed
+}
+
+func (hash collideHash) Seed() maphash.Seed {
+	return hash.seed
+}
+
+func (hash collideHash) Hash(key string) uint64 {
+	return 1
+}
+
+// 测试删除中间溢出桶的全部元素，之后溢出桶的key仍能找到
+func TestDeleteOverflow(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(1 << 4)
+	m.mapHash = collideHash{m.seed}
+	count := 32
+	for i := 0; i < count; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	for i := 8; i < 16; i++ {
+		m.Delete(strconv.Itoa(i))
+	}
+	for i := 16; i < count; i++ {
+		val, ok := m.Get(strconv.Itoa(i))
+		assert.True(ok, i)
+		assert.Equal(i, val, i)
+	}
+}
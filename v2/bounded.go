@@ -0,0 +1,322 @@
+package v2
+
+import (
+	"unsafe"
+)
+
+// 计算元素占用的字节数，通常是key和val的大小
+type Weigher func(key string, val interface{}) int64
+
+// 淘汰策略，BoundedMap超过预算时通过Victim选择淘汰的key
+// 只在BoundedMap中同步调用，不需要并发安全
+type EvictionPolicy interface {
+	Add(key string, weight int64) // 新增或更新
+	Access(key string)            // Get命中
+	Remove(key string)            // 删除或淘汰
+	Victim() (string, bool)       // 下一个淘汰的key，没有元素时返回false
+}
+
+type BoundedOptions struct {
+	MaxBytes int64                             // 字节预算，必须大于0
+	Weigher  Weigher                           // 必须设置
+	Policy   EvictionPolicy                    // 默认为LRU
+	OnEvict  func(key string, val interface{}) // 元素因超过预算被淘汰时调用
+	Cap      int                               // map的预设容量
+}
+
+// 占用情况，Total为Weight，Entries个元素的额外开销，和所有正常桶与溢出桶的大小之和
+type BoundedStats struct {
+	Entries     int
+	Weight      int64 // Weigher计算的大小之和
+	Buckets     int   // 正常桶个数
+	Overflow    int   // 溢出桶个数
+	OldBuckets  int   // 扩容中还未释放的旧正常桶和旧溢出桶个数
+	BucketBytes int64 // 正常桶，溢出桶和旧桶的大小
+	Total       int64
+	MaxBytes    int64
+	Evictions   uint64 // 累计淘汰的元素个数
+}
+
+// 按字节数限制大小的map，超过MaxBytes时按淘汰策略淘汰元素
+// 占用的大小包括bmap和溢出桶，扩容中的旧桶在迁移完成前也计入
+// 不支持并发安全
+type BoundedMap struct {
+	hm        *hmap // val为*boundedEntry
+	weigher   Weigher
+	policy    EvictionPolicy
+	onEvict   func(key string, val interface{})
+	maxBytes  int64
+	weight    int64
+	evictions uint64
+}
+
+type boundedEntry struct {
+	val    interface{}
+	weight int64
+}
+
+var (
+	bmapSize   = int64(unsafe.Sizeof(bmap{}) + unsafe.Sizeof((*bmap)(nil)))
+	bentrySize = int64(unsafe.Sizeof(boundedEntry{}))
+)
+
+func NewBoundedMap(opts *BoundedOptions) *BoundedMap {
+	if opts == nil || opts.MaxBytes <= 0 {
+		panic("max bytes error")
+	}
+	if opts.Weigher == nil {
+		panic("weigher is nil")
+	}
+	policy := opts.Policy
+	if policy == nil {
+		policy = NewLRUPolicy()
+	}
+	m := &BoundedMap{
+		hm:       NewHMap(opts.Cap),
+		weigher:  opts.Weigher,
+		policy:   policy,
+		onEvict:  opts.OnEvict,
+		maxBytes: opts.MaxBytes,
+	}
+	return m
+}
+
+// 插入或更新，超过预算时淘汰元素，返回key是否还在map中
+// 元素本身加上额外开销，当前所有的桶，和扩容缩容可能新分配的桶超过预算时不插入
+// 只对它调用OnEvict，不淘汰其他元素，更新时原来的val会被删除，不调用OnEvict
+func (m *BoundedMap) Set(key string, val interface{}) bool {
+	weight := m.weigher(key, val)
+	if weight < 0 {
+		panic("negative weight")
+	}
+	if weight > m.maxBytes-bentrySize-m.hm.bucketBytes()-m.hm.growBytes() {
+		m.Delete(key)
+		m.evictions++
+		if m.onEvict != nil {
+			m.onEvict(key, val)
+		}
+		return false
+	}
+	hash := m.hm.mapHash.Hash(key)
+	if v, ok := m.hm.lookup(key, hash); ok {
+		e := v.(*boundedEntry)
+		m.weight += weight - e.weight
+		e.val = val
+		e.weight = weight
+	} else {
+		if m.hm.assign(key, &boundedEntry{val: val, weight: weight}, hash) {
+			m.hm.count++
+			m.hm.checkFlood()
+		}
+		m.weight += weight
+	}
+	m.policy.Add(key, weight)
+	m.evict()
+	_, ok := m.hm.Get(key)
+	return ok
+}
+
+// 查找，命中时通知淘汰策略
+func (m *BoundedMap) Get(key string) (interface{}, bool) {
+	v, ok := m.hm.Get(key)
+	if !ok {
+		return nil, false
+	}
+	m.policy.Access(key)
+	return v.(*boundedEntry).val, true
+}
+
+// 查找，不通知淘汰策略
+func (m *BoundedMap) Peek(key string) (interface{}, bool) {
+	v, ok := m.hm.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return v.(*boundedEntry).val, true
+}
+
+// 删除key，不调用OnEvict，返回key是否存在
+func (m *BoundedMap) Delete(key string) bool {
+	if !m.remove(key) {
+		return false
+	}
+	m.policy.Remove(key)
+	return true
+}
+
+func (m *BoundedMap) Count() int {
+	return m.hm.Count()
+}
+
+// 当前占用的字节数
+func (m *BoundedMap) Usage() int64 {
+	return m.weight + int64(m.hm.count)*bentrySize + m.hm.bucketBytes()
+}
+
+func (m *BoundedMap) Stats() BoundedStats {
+	return BoundedStats{
+		Entries:     m.hm.Count(),
+		Weight:      m.weight,
+		Buckets:     len(m.hm.buckets),
+		Overflow:    len(m.hm.overflowBuckets),
+		OldBuckets:  len(m.hm.oldBuckets) + len(m.hm.oldOverflowBuckets),
+		BucketBytes: m.hm.bucketBytes(),
+		Total:       m.Usage(),
+		MaxBytes:    m.maxBytes,
+		Evictions:   m.evictions,
+	}
+}
+
+// 修改预算，变小时立即淘汰，返回淘汰的个数
+func (m *BoundedMap) Resize(maxBytes int64) int {
+	if maxBytes <= 0 {
+		panic("max bytes error")
+	}
+	m.maxBytes = maxBytes
+	before := m.evictions
+	m.evict()
+	return int(m.evictions - before)
+}
+
+// 遍历，不通知淘汰策略，f中不能修改map
+func (m *BoundedMap) Range(f func(key string, val interface{}) bool) {
+	m.hm.Range(func(key string, val interface{}) bool {
+		return f(key, val.(*boundedEntry).val)
+	})
+}
+
+// 超过预算时按策略淘汰，直到不超过或者没有元素
+func (m *BoundedMap) evict() {
+	for m.Usage() > m.maxBytes {
+		key, ok := m.policy.Victim()
+		if !ok {
+			return
+		}
+		v, _ := m.hm.Get(key)
+		m.policy.Remove(key)
+		if !m.remove(key) {
+			continue
+		}
+		m.evictions++
+		if m.onEvict != nil {
+			m.onEvict(key, v.(*boundedEntry).val)
+		}
+	}
+}
+
+func (m *BoundedMap) remove(key string) bool {
+	v, ok := m.hm.Get(key)
+	if !ok {
+		return false
+	}
+	m.weight -= v.(*boundedEntry).weight
+	m.hm.Delete(key)
+	return true
+}
+
+// 正常桶，溢出桶和扩容中的旧桶占用的字节数，包括切片中的指针
+func (hm *hmap) bucketBytes() int64 {
+	n := len(hm.buckets) + len(hm.overflowBuckets) + len(hm.oldBuckets) + len(hm.oldOverflowBuckets)
+	return int64(n) * bmapSize
+}
+
+// 新增一个元素以及之后淘汰元素时，扩容缩容最多新分配的桶占用的字节数
+// 还未分配桶时为第一个正常桶，扩容中为迁移时可能新建的溢出桶
+// 需要扩容时为新的正常桶，可以缩容时为缩容后的正常桶
+// 不包括新增元素可能创建的一个溢出桶，超出时最多再淘汰几个元素
+func (hm *hmap) growBytes() int64 {
+	if hm.buckets == nil {
+		return bmapSize
+	}
+	if hm.growing() {
+		return int64(len(hm.oldOverflowBuckets)) * bmapSize
+	}
+	n := 0
+	if hm.testhashGrow() {
+		B := hm.b
+		if overLoadFactor(hm.count+1, hm.bucketCount) {
+			B++
+		}
+		n += 1 << B
+	} else if hm.b > capb(hm.cap) {
+		n += 1 << (hm.b - 1)
+	}
+	return int64(n) * bmapSize
+}
+
+// 按key记录顺序的淘汰策略，Victim返回最久的元素
+// access为true时Access移到最新，即LRU，否则为FIFO
+type listPolicy struct {
+	hm     *hmap // val为*lruEntry
+	root   lruEntry
+	access bool
+}
+
+// 淘汰最久未访问的元素
+func NewLRUPolicy() EvictionPolicy {
+	return newListPolicy(true)
+}
+
+// 淘汰最早插入的元素，更新和访问不改变顺序
+func NewFIFOPolicy() EvictionPolicy {
+	return newListPolicy(false)
+}
+
+func newListPolicy(access bool) *listPolicy {
+	p := &listPolicy{hm: NewHMap(0), access: access}
+	p.root.prev = &p.root
+	p.root.next = &p.root
+	return p
+}
+
+func (p *listPolicy) Add(key string, weight int64) {
+	if _, ok := p.hm.Get(key); ok {
+		p.Access(key)
+		return
+	}
+	e := &lruEntry{key: key}
+	p.hm.Set(key, e)
+	p.pushFront(e)
+}
+
+func (p *listPolicy) Access(key string) {
+	if !p.access {
+		return
+	}
+	v, ok := p.hm.Get(key)
+	if !ok {
+		return
+	}
+	e := v.(*lruEntry)
+	p.unlink(e)
+	p.pushFront(e)
+}
+
+func (p *listPolicy) Remove(key string) {
+	v, ok := p.hm.Get(key)
+	if !ok {
+		return
+	}
+	p.unlink(v.(*lruEntry))
+	p.hm.Delete(key)
+}
+
+func (p *listPolicy) Victim() (string, bool) {
+	if p.root.prev == &p.root {
+		return "", false
+	}
+	return p.root.prev.key, true
+}
+
+func (p *listPolicy) pushFront(e *lruEntry) {
+	e.prev = &p.root
+	e.next = p.root.next
+	p.root.next.prev = e
+	p.root.next = e
+}
+
+func (p *listPolicy) unlink(e *lruEntry) {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	e.prev, e.next = nil, nil
+}
@@ -0,0 +1,211 @@
+package v2
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func stringWeigher(key string, val interface{}) int64 {
+	return int64(len(key) + len(val.(string)))
+}
+
+func TestBounded1(t *testing.T) {
+	assert := assert.New(t)
+	var evicted []string
+	// 1个正常桶，4个元素的额外开销，再加400字节
+	max := bmapSize + 4*bentrySize + 400
+	m := NewBoundedMap(&BoundedOptions{MaxBytes: max, Weigher: stringWeigher, OnEvict: func(key string, val interface{}) {
+		evicted = append(evicted, key)
+	}})
+	for _, key := range []string{"a", "b", "c", "d"} {
+		assert.True(m.Set(key, strings.Repeat(key, 99)))
+	}
+	assert.Equal(4, m.Count())
+	assert.Equal(max, m.Usage())
+	assert.Empty(evicted)
+
+	// a最近访问过，淘汰b
+	val, ok := m.Get("a")
+	assert.True(ok)
+	assert.Equal(strings.Repeat("a", 99), val)
+	assert.True(m.Set("e", strings.Repeat("e", 99)))
+	assert.Equal([]string{"b"}, evicted)
+
+	// 更新变大，淘汰两个
+	assert.True(m.Set("e", strings.Repeat("e", 299)))
+	assert.Equal([]string{"b", "c", "d"}, evicted)
+	assert.Equal(2, m.Count())
+
+	// 本身超过预算，不插入，不淘汰其他元素
+	assert.False(m.Set("f", strings.Repeat("f", 1000)))
+	assert.Equal([]string{"b", "c", "d", "f"}, evicted)
+	assert.Equal(2, m.Count())
+	// 更新为超过预算的val，删除原来的元素
+	assert.False(m.Set("e", strings.Repeat("e", 1000)))
+	assert.Equal([]string{"b", "c", "d", "f", "e"}, evicted)
+	_, ok = m.Peek("e")
+	assert.False(ok)
+	m.Delete("a")
+	assert.Equal(0, m.Count())
+	assert.Equal(bmapSize, m.Usage())
+
+	assert.True(m.Set("g", "g"))
+	assert.True(m.Delete("g"))
+	assert.False(m.Delete("g"))
+	stats := m.Stats()
+	assert.Equal(BoundedStats{Buckets: 1, BucketBytes: bmapSize, Total: bmapSize, MaxBytes: max, Evictions: 5}, stats)
+}
+
+// 超过预算的元素不会淘汰其他元素
+func TestBoundedOversized(t *testing.T) {
+	assert := assert.New(t)
+	var evicted []string
+	m := NewBoundedMap(&BoundedOptions{MaxBytes: 1 << 20, Weigher: stringWeigher, OnEvict: func(key string, val interface{}) {
+		evicted = append(evicted, key)
+	}})
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		assert.True(m.Set(key, strings.Repeat("x", 1<<10-len(key))))
+	}
+	assert.False(m.Set("huge", strings.Repeat("x", 2<<20)))
+	assert.Equal([]string{"huge"}, evicted)
+	assert.Equal(100, m.Count())
+	assert.Equal(uint64(1), m.Stats().Evictions)
+
+	// 刚好放得下一个元素和一个桶
+	m = NewBoundedMap(&BoundedOptions{MaxBytes: bmapSize + bentrySize + 100, Weigher: stringWeigher})
+	assert.True(m.Set("k", strings.Repeat("x", 99)))
+	assert.False(m.Set("k", strings.Repeat("x", 100)))
+	assert.Equal(0, m.Count())
+}
+
+// 接近预算时，只按一个桶计算能放下，但加上已有的桶放不下的元素，不插入也不淘汰其他元素
+func TestBoundedOversizedFull(t *testing.T) {
+	assert := assert.New(t)
+	var evicted []string
+	max := int64(1 << 20)
+	m := NewBoundedMap(&BoundedOptions{MaxBytes: max, Weigher: stringWeigher, OnEvict: func(key string, val interface{}) {
+		evicted = append(evicted, key)
+	}})
+	for i := 0; m.Usage() < max*9/10; i++ {
+		key := strconv.Itoa(i)
+		assert.True(m.Set(key, strings.Repeat("x", 100-len(key))))
+	}
+	assert.Empty(evicted)
+	count := m.Count()
+	assert.Greater(m.hm.bucketBytes(), 2*bmapSize)
+
+	big := int(max - bentrySize - bmapSize - 3)
+	assert.False(m.Set("big", strings.Repeat("x", big)))
+	assert.Equal([]string{"big"}, evicted)
+	assert.Equal(count, m.Count())
+
+	// 不超过当前的桶和可能新分配的桶时可以插入，淘汰其他元素后不超过预算
+	fit := int(max - bentrySize - m.hm.bucketBytes() - m.hm.growBytes() - 3)
+	assert.True(m.Set("fit", strings.Repeat("x", fit)))
+	assert.LessOrEqual(m.Usage(), max)
+	_, ok := m.Peek("fit")
+	assert.True(ok)
+	assert.Greater(len(evicted), 1)
+}
+
+// 占用的大小包括正常桶，溢出桶和每个元素的额外开销
+func TestBoundedUsage(t *testing.T) {
+	assert := assert.New(t)
+	m := NewBoundedMap(&BoundedOptions{MaxBytes: 1 << 40, Weigher: stringWeigher})
+	weight := int64(0)
+	for i := 0; i < 10000; i++ {
+		key := strconv.Itoa(i)
+		m.Set(key, key)
+		weight += int64(2 * len(key))
+		stats := m.Stats()
+		assert.Equal(weight, stats.Weight)
+		assert.Equal(int64(stats.Buckets+stats.Overflow+stats.OldBuckets)*bmapSize, stats.BucketBytes)
+		assert.Equal(len(m.hm.oldBuckets)+len(m.hm.oldOverflowBuckets), stats.OldBuckets)
+		assert.Equal(stats.Weight+int64(stats.Entries)*bentrySize+stats.BucketBytes, stats.Total)
+	}
+	stats := m.Stats()
+	assert.Equal(len(m.hm.buckets), stats.Buckets)
+	assert.Equal(len(m.hm.overflowBuckets), stats.Overflow)
+	assert.Greater(stats.Buckets, 10000/8)
+
+	// 放不下前一半，按LRU淘汰最早插入的元素
+	// 删除后空的溢出桶被移除，淘汰的个数可能略少于一半
+	half := int64(0)
+	for i := 0; i < 5000; i++ {
+		half += int64(2 * len(strconv.Itoa(i)))
+	}
+	n := m.Resize(m.Usage() - half - 5000*bentrySize)
+	assert.LessOrEqual(n, 5000)
+	assert.Greater(n, 4900)
+	assert.LessOrEqual(m.Usage(), m.Stats().MaxBytes)
+	for i := 0; i < 10000; i++ {
+		_, ok := m.Peek(strconv.Itoa(i))
+		assert.Equal(i >= n, ok, i)
+	}
+}
+
+func TestBoundedFIFO(t *testing.T) {
+	assert := assert.New(t)
+	m := NewBoundedMap(&BoundedOptions{MaxBytes: bmapSize + 3*bentrySize + 6, Weigher: stringWeigher, Policy: NewFIFOPolicy()})
+	m.Set("a", "1")
+	m.Set("b", "2")
+	m.Set("c", "3")
+	m.Get("a")
+	m.Set("a", "4")
+	m.Set("d", "5")
+	// FIFO不因为访问和更新改变顺序
+	_, ok := m.Peek("a")
+	assert.False(ok)
+	assert.Equal(3, m.Count())
+}
+
+// 优先淘汰最大的元素
+type largestPolicy struct {
+	weights map[string]int64
+}
+
+func (p *largestPolicy) Add(key string, weight int64) {
+	p.weights[key] = weight
+}
+
+func (p *largestPolicy) Access(key string) {}
+
+func (p *largestPolicy) Remove(key string) {
+	delete(p.weights, key)
+}
+
+func (p *largestPolicy) Victim() (string, bool) {
+	victim, max := "", int64(-1)
+	for key, weight := range p.weights {
+		if weight > max {
+			victim, max = key, weight
+		}
+	}
+	return victim, max >= 0
+}
+
+func TestBoundedPolicy(t *testing.T) {
+	assert := assert.New(t)
+	var evicted []string
+	m := NewBoundedMap(&BoundedOptions{
+		MaxBytes: bmapSize + 3*bentrySize + 30,
+		Weigher:  stringWeigher,
+		Policy:   &largestPolicy{weights: make(map[string]int64)},
+		OnEvict: func(key string, val interface{}) {
+			evicted = append(evicted, key)
+		},
+	})
+	m.Set("a", strings.Repeat("1", 9))
+	m.Set("b", strings.Repeat("2", 19))
+	m.Set("c", strings.Repeat("3", 4))
+	assert.Equal([]string{"b"}, evicted)
+	m.Set("d", strings.Repeat("4", 14))
+	assert.Equal([]string{"b"}, evicted)
+	m.Set("e", strings.Repeat("5", 1))
+	assert.Equal([]string{"b", "d"}, evicted)
+	assert.Equal(3, m.Count())
+}
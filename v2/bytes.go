@@ -0,0 +1,57 @@
+package v2
+
+import (
+	"hash/maphash"
+	"strings"
+	"unsafe"
+)
+
+// 可以直接计算[]byte哈希值的Hash，结果必须与Hash(string(b))相同
+type BytesHash interface {
+	HashBytes(b []byte) uint64
+}
+
+// 与maphash.Hash.Write再Sum64的结果相同，不分配内存
+func (hash *mapHash) HashBytes(b []byte) uint64 {
+	return maphash.Bytes(hash.seed, b)
+}
+
+// 以[]byte为key查找，不复制key，不分配内存
+func (hm *hmap) GetBytes(key []byte) (interface{}, bool) {
+	return hm.lookup(bytesView(key), hm.hashBytes(key))
+}
+
+// 以[]byte为key插入或更新，只有新增时才复制key
+func (hm *hmap) SetBytes(key []byte, val interface{}) {
+	if hm.assignKey(bytesView(key), val, hm.hashBytes(key), true) {
+		hm.count++
+		hm.checkFlood()
+	}
+}
+
+// 以[]byte为key删除，不复制key
+func (hm *hmap) DeleteBytes(key []byte) {
+	if hm.remove(bytesView(key), hm.hashBytes(key)) {
+		hm.count--
+	}
+}
+
+func (hm *hmap) hashBytes(key []byte) uint64 {
+	if bh, ok := hm.mapHash.(BytesHash); ok {
+		return bh.HashBytes(key)
+	}
+	return hm.mapHash.Hash(bytesView(key))
+}
+
+// 不复制地将b当作string使用，只能用于查找和比较，不能保存到桶中
+func bytesView(b []byte) string {
+	return unsafe.String(unsafe.SliceData(b), len(b))
+}
+
+// 新增时复制key，key可能是bytesView
+func cloneKey(key string, copyKey bool) string {
+	if copyKey {
+		return strings.Clone(key)
+	}
+	return key
+}
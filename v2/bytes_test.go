@@ -0,0 +1,126 @@
+package v2
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBytes1(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(0)
+	buf := make([]byte, 0, 16)
+	count := 1 << 12
+	for i := 0; i < count; i++ {
+		buf = strconv.AppendInt(buf[:0], int64(i), 10)
+		m.SetBytes(buf, i)
+	}
+	// 修改buf不影响map中的key
+	buf = append(buf[:0], "xxxx"...)
+	assert.Equal(count, m.Count())
+	for i := 0; i < count; i++ {
+		val, ok := m.Get(strconv.Itoa(i))
+		assert.True(ok, i)
+		assert.Equal(i, val)
+		val, ok = m.GetBytes([]byte(strconv.Itoa(i)))
+		assert.True(ok, i)
+		assert.Equal(i, val)
+	}
+	m.Range(func(key string, val interface{}) bool {
+		assert.Equal(strconv.Itoa(val.(int)), key)
+		return true
+	})
+
+	m.SetBytes([]byte("1"), "a")
+	val, _ := m.Get("1")
+	assert.Equal("a", val)
+	assert.Equal(count, m.Count())
+	for i := 0; i < count; i += 2 {
+		m.DeleteBytes([]byte(strconv.Itoa(i)))
+	}
+	m.DeleteBytes([]byte("x"))
+	assert.Equal(count/2, m.Count())
+	_, ok := m.GetBytes([]byte("0"))
+	assert.False(ok)
+	_, ok = m.GetBytes(nil)
+	assert.False(ok)
+	m.SetBytes(nil, "empty")
+	val, _ = m.Get("")
+	assert.Equal("empty", val)
+}
+
+// 测试HashBytes与Hash结果相同，不实现BytesHash的Hash也可以使用
+func TestHashBytes(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(0)
+	for _, key := range []string{"", "a", "hello world", string(make([]byte, 100))} {
+		assert.Equal(m.mapHash.Hash(key), m.hashBytes([]byte(key)))
+	}
+	m.mapHash = fixedHash{seed: m.seed, hash: 7}
+	assert.Equal(uint64(7), m.hashBytes([]byte("a")))
+	m.SetBytes([]byte("a"), 1)
+	m.SetBytes([]byte("b"), 2)
+	val, _ := m.GetBytes([]byte("b"))
+	assert.Equal(2, val)
+}
+
+// 测试查找，更新，删除不存在的key不分配内存
+func TestBytesAlloc(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(0)
+	keys := make([][]byte, 1000)
+	for i := range keys {
+		keys[i] = []byte(strconv.Itoa(i))
+		m.SetBytes(keys[i], i)
+	}
+	var val interface{} = "v"
+	missing := []byte("missing")
+	allocs := testing.AllocsPerRun(100, func() {
+		for _, key := range keys {
+			m.GetBytes(key)
+			m.SetBytes(key, val)
+		}
+		m.GetBytes(missing)
+		m.DeleteBytes(missing)
+	})
+	assert.Equal(float64(0), allocs)
+}
+
+func BenchmarkGetBytes(b *testing.B) {
+	m := NewHMap(0)
+	keys := make([][]byte, 1<<16)
+	for i := range keys {
+		keys[i] = []byte(strconv.Itoa(i))
+		m.SetBytes(keys[i], i)
+	}
+	b.Run("GetBytes", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			m.GetBytes(keys[i&(len(keys)-1)])
+		}
+	})
+	b.Run("Get", func(b *testing.B) {
+		b.ReportAllocs()
+		var sink string
+		for i := 0; i < b.N; i++ {
+			sink = string(keys[i&(len(keys)-1)])
+			m.Get(sink)
+		}
+	})
+}
+
+func BenchmarkSetBytes(b *testing.B) {
+	m := NewHMap(0)
+	keys := make([][]byte, 1<<16)
+	for i := range keys {
+		keys[i] = []byte(strconv.Itoa(i))
+		m.SetBytes(keys[i], i)
+	}
+	var val interface{} = "v"
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.SetBytes(keys[i&(len(keys)-1)], val)
+	}
+}
@@ -0,0 +1,155 @@
+package v2
+
+import (
+	"hash/maphash"
+	"sync"
+)
+
+// 分片个数最大值，分片由hash值的第48到55位决定
+// 不使用最高八位，避免同一分片内tophash都相同
+const (
+	maxShardBits = 8
+	shardShift   = 64 - 8 - maxShardBits
+)
+
+// 并发安全的map，将key按hash值的高位分到多个hmap中，每个分片一把读写锁
+// 分片中的链表过长时，只有这个分片重新设置种子，之后分片内使用自己的哈希函数
+type ConcurrentMap struct {
+	shards    []shard
+	shardBits uint8        // 当前设置2^shardBits为分片的个数
+	mapHash   Hash         //hash函数，用于选择分片，分片重新设置种子之前也在分片内使用
+	seed      maphash.Seed // 类似于hash0
+	hashID    *hashID      // mapHash的标识，与分片的hashID不同时说明分片重新设置过种子
+}
+
+type shard struct {
+	mu sync.RWMutex
+	hm *hmap
+}
+
+// shardCount为分片个数，向上取整为2的幂，最大256
+// cap为整个map预设的容量，平均分到每个分片
+func NewConcurrentMap(shardCount int, cap int) *ConcurrentMap {
+	if shardCount <= 0 || shardCount > 1<<maxShardBits {
+		panic("shard count error")
+	}
+	if cap < 0 || cap > 1<<30 {
+		panic("cap error")
+	}
+	cm := new(ConcurrentMap)
+	for 1<<cm.shardBits < shardCount {
+		cm.shardBits++
+	}
+	cm.seed = maphash.MakeSeed()
+	cm.mapHash = newMapHash(cm.seed)
+	cm.hashID = new(hashID)
+	cm.shards = make([]shard, 1<<cm.shardBits)
+	for i := range cm.shards {
+		hm := makemap(uint(cap >> cm.shardBits))
+		hm.seed = cm.seed
+		hm.setHash(cm.mapHash)
+		hm.hashID = cm.hashID
+		cm.shards[i].hm = hm
+	}
+	return cm
+}
+
+func (cm *ConcurrentMap) Set(key string, val interface{}) {
+	hash := cm.mapHash.Hash(key)
+	s := cm.shard(hash)
+	s.mu.Lock()
+	if s.hm.assign(key, val, cm.rehash(s, key, hash)) {
+		s.hm.count++
+		s.hm.checkFlood()
+	}
+	s.mu.Unlock()
+}
+
+// Get不会迁移旧桶，只需要读锁
+func (cm *ConcurrentMap) Get(key string) (interface{}, bool) {
+	hash := cm.mapHash.Hash(key)
+	s := cm.shard(hash)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.hm.lookup(key, cm.rehash(s, key, hash))
+}
+func (cm *ConcurrentMap) Delete(key string) {
+	hash := cm.mapHash.Hash(key)
+	s := cm.shard(hash)
+	s.mu.Lock()
+	if s.hm.remove(key, cm.rehash(s, key, hash)) {
+		s.hm.count--
+	}
+	s.mu.Unlock()
+}
+
+// 所有分片重新设置种子的次数之和
+func (cm *ConcurrentMap) Reseeds() uint64 {
+	reseeds := uint64(0)
+	for i := range cm.shards {
+		s := &cm.shards[i]
+		s.mu.RLock()
+		reseeds += s.hm.Reseeds()
+		s.mu.RUnlock()
+	}
+	return reseeds
+}
+
+// 所有分片元素个数之和，各分片分别加锁，并发修改时只是近似值
+func (cm *ConcurrentMap) Count() int {
+	count := 0
+	for i := range cm.shards {
+		s := &cm.shards[i]
+		s.mu.RLock()
+		count += s.hm.Count()
+		s.mu.RUnlock()
+	}
+	return count
+}
+
+// 依次遍历每个分片，f返回false时停止
+// 每个分片加锁复制出所有元素后再调用f，f中可以修改map
+// 遍历中的修改不保证能遍历到
+func (cm *ConcurrentMap) Range(f func(key string, val interface{}) bool) {
+	for i := range cm.shards {
+		s := &cm.shards[i]
+		// 开始遍历可能完成缩容，需要写锁
+		s.mu.Lock()
+		keys := make([]string, 0, s.hm.Count())
+		vals := make([]interface{}, 0, s.hm.Count())
+		s.hm.Range(func(key string, val interface{}) bool {
+			keys = append(keys, key)
+			vals = append(vals, val)
+			return true
+		})
+		s.mu.Unlock()
+		for j := range keys {
+			if !f(keys[j], vals[j]) {
+				return
+			}
+		}
+	}
+}
+
+// 分片的个数
+func (cm *ConcurrentMap) ShardCount() int {
+	return len(cm.shards)
+}
+
+// 由hash值的高位选择分片
+func (cm *ConcurrentMap) shard(hash uint64) *shard {
+	return &cm.shards[calshard(hash, cm.shardBits)]
+}
+
+// 持有分片的锁时调用，分片重新设置过种子时，用分片的哈希函数重新计算
+func (cm *ConcurrentMap) rehash(s *shard, key string, hash uint64) uint64 {
+	if s.hm.hashID != cm.hashID {
+		return s.hm.mapHash.Hash(key)
+	}
+	return hash
+}
+
+// 计算分片的位置，也就是hash值第48位开始的shardBits位
+func calshard(hash uint64, shardBits uint8) uint64 {
+	return hash >> shardShift & (1<<shardBits - 1)
+}
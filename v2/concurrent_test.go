@@ -0,0 +1,148 @@
+package v2
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试分片个数
+func TestNewConcurrentMap(t *testing.T) {
+	assert := assert.New(t)
+	table := []struct {
+		shardCount int
+		shards     int
+		panic      bool
+	}{
+		{1, 1, false},
+		{3, 4, false},
+		{16, 16, false},
+		{256, 256, false},
+		{0, 0, true},
+		{257, 0, true},
+	}
+	for _, v := range table {
+		if v.panic {
+			assert.Panics(func() {
+				NewConcurrentMap(v.shardCount, 0)
+			}, v.shardCount)
+			continue
+		}
+		cm := NewConcurrentMap(v.shardCount, 1<<10)
+		assert.Equal(v.shards, cm.ShardCount(), v.shardCount)
+	}
+	assert.Panics(func() {
+		NewConcurrentMap(1, -1)
+	})
+}
+
+// 测试key分布到各个分片
+func TestConcurrentMapShard(t *testing.T) {
+	assert := assert.New(t)
+	cm := NewConcurrentMap(16, 0)
+	count := 1 << 12
+	for i := 0; i < count; i++ {
+		cm.Set(strconv.Itoa(i), i)
+	}
+	assert.Equal(count, cm.Count())
+	for i := range cm.shards {
+		assert.Greater(cm.shards[i].hm.Count(), 0, i)
+	}
+	assert.Equal(uint64(0xab), calshard(0xab<<48, 8))
+	assert.Equal(uint64(0xb), calshard(0xab<<48, 4))
+}
+
+// 所有key都冲突时，分片重新设置种子，之后在分片内使用自己的哈希函数
+func TestConcurrentMapReseed(t *testing.T) {
+	assert := assert.New(t)
+	cm := NewConcurrentMap(4, 0)
+	cm.mapHash = collideHash{cm.seed}
+	for i := range cm.shards {
+		cm.shards[i].hm.mapHash = cm.mapHash
+	}
+	count := 1 << 10
+	for i := 0; i < count; i++ {
+		cm.Set(strconv.Itoa(i), i)
+	}
+	assert.Greater(cm.Reseeds(), uint64(0))
+	s := cm.shard(1)
+	assert.False(cm.hashID == s.hm.hashID)
+	assert.LessOrEqual(maxChain(s.hm), floodThreshold(s.hm.b)+1)
+	for i := 0; i < count; i += 2 {
+		cm.Delete(strconv.Itoa(i))
+	}
+	assert.Equal(count/2, cm.Count())
+	for i := 0; i < count; i++ {
+		val, ok := cm.Get(strconv.Itoa(i))
+		assert.Equal(i%2 == 1, ok, i)
+		if ok {
+			assert.Equal(i, val, i)
+		}
+	}
+}
+
+// 测试并发Set，Get，Delete
+func TestConcurrentMapParallel(t *testing.T) {
+	assert := assert.New(t)
+	cm := NewConcurrentMap(8, 0)
+	workers := 8
+	count := 1 << 11
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				key := strconv.Itoa(w*count + i)
+				cm.Set(key, i)
+				val, ok := cm.Get(key)
+				assert.True(ok, key)
+				assert.Equal(i, val, key)
+				if i%2 == 0 {
+					cm.Delete(key)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	assert.Equal(workers*count/2, cm.Count())
+	for w := 0; w < workers; w++ {
+		for i := 0; i < count; i++ {
+			_, ok := cm.Get(strconv.Itoa(w*count + i))
+			assert.Equal(i%2 == 1, ok, i)
+		}
+	}
+}
+
+// 测试Range，遍历中可以修改
+func TestConcurrentMapRange(t *testing.T) {
+	assert := assert.New(t)
+	cm := NewConcurrentMap(4, 0)
+	count := 1 << 10
+	for i := 0; i < count; i++ {
+		cm.Set(strconv.Itoa(i), i)
+	}
+	seen := make(map[string]int)
+	cm.Range(func(key string, val interface{}) bool {
+		seen[key]++
+		assert.Equal(key, strconv.Itoa(val.(int)))
+		cm.Delete(key)
+		return true
+	})
+	assert.Equal(count, len(seen))
+	for k, n := range seen {
+		assert.Equal(1, n, k)
+	}
+	assert.Equal(0, cm.Count())
+
+	n := 0
+	cm.Set("a", 1)
+	cm.Set("b", 2)
+	cm.Range(func(key string, val interface{}) bool {
+		n++
+		return false
+	})
+	assert.Equal(1, n)
+}
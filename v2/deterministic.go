@@ -0,0 +1,45 @@
+package v2
+
+// 由64位种子创建Hash，确定性模式使用
+type SeedFunc func(seed uint64) Hash
+
+// 确定性模式，所有的哈希和随机数都由seed派生，使用wyhash
+// 相同的seed和相同的操作顺序，得到相同的桶分布，遍历顺序和快照
+func WithSeed(seed uint64) Option {
+	return WithSeedHash(seed, NewWyHash)
+}
+
+// 确定性模式，使用f创建的哈希函数
+// 重新设置种子时，新的种子也由seed派生，f不使用种子时不重新设置
+func WithSeedHash(seed uint64, f SeedFunc) Option {
+	return func(hm *hmap) {
+		hm.seedFunc = f
+		hm.rng = seed
+		hm.setHash(f(hm.nextRand()))
+		hm.unkeyed = unkeyedSeedHash(f)
+	}
+}
+
+// 与unkeyedHash相同，种子固定，不影响确定性
+func unkeyedSeedHash(f SeedFunc) bool {
+	return f(1).Hash(probeKey) == f(2).Hash(probeKey)
+}
+
+// 是否为确定性模式
+func (hm *hmap) Deterministic() bool {
+	return hm.seedFunc != nil
+}
+
+// 确定性模式下由种子派生的随机数，否则为真随机数
+func (hm *hmap) nextRand() uint64 {
+	return splitmix64(&hm.rng)
+}
+
+// splitmix64，状态每次增加一个常数
+func splitmix64(state *uint64) uint64 {
+	*state += 0x9e3779b97f4a7c15
+	z := *state
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	return z ^ z>>31
+}
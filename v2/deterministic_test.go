@@ -0,0 +1,112 @@
+package v2
+
+import (
+	"bytes"
+	"hash/crc32"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 相同的种子和操作得到相同的桶分布，遍历顺序和快照
+func TestDeterministic(t *testing.T) {
+	assert := assert.New(t)
+	build := func(seed uint64) *hmap {
+		m := NewHMap(0, WithSeed(seed))
+		for i := 0; i < 1000; i++ {
+			m.Set(strconv.Itoa(i), i)
+		}
+		for i := 0; i < 1000; i += 3 {
+			m.Delete(strconv.Itoa(i))
+		}
+		return m
+	}
+	m1, m2 := build(42), build(42)
+	assert.True(m1.Deterministic())
+	assert.Equal(layout(m1), layout(m2))
+	assert.Equal(rangeKeys(m1), rangeKeys(m2))
+	// 每次遍历的开始位置不同，但两个map的序列相同
+	assert.Equal(rangeKeys(m1), rangeKeys(m2))
+
+	var buf1, buf2 bytes.Buffer
+	_, err := m1.WriteTo(&buf1)
+	assert.Nil(err)
+	_, err = m2.WriteTo(&buf2)
+	assert.Nil(err)
+	assert.Equal(buf1.Bytes(), buf2.Bytes())
+
+	m3 := build(43)
+	assert.NotEqual(layout(m1), layout(m3))
+	assert.False(NewHMap(0).Deterministic())
+}
+
+// 快照在不同的运行之间保持不变
+func TestDeterministicGolden(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(0, WithSeed(1))
+	for i := 0; i < 100; i++ {
+		m.Set("key"+strconv.Itoa(i), "val"+strconv.Itoa(i))
+	}
+	var buf bytes.Buffer
+	_, err := m.WriteTo(&buf)
+	assert.Nil(err)
+	assert.Equal(uint32(goldenSnapshotCRC), crc32.ChecksumIEEE(buf.Bytes()))
+	assert.Equal([]string{"key36", "key48", "key71"}, rangeKeys(m)[:3])
+}
+
+// 确定性模式下重新设置种子也是确定的
+func TestDeterministicReseed(t *testing.T) {
+	assert := assert.New(t)
+	build := func() *hmap {
+		calls := 0
+		m := NewHMap(0, WithSeedHash(7, func(seed uint64) Hash {
+			calls++
+			if calls == 1 {
+				return collideHash{}
+			}
+			return NewXXH64(seed)
+		}))
+		for i := 0; i < 200; i++ {
+			m.Set(strconv.Itoa(i), i)
+		}
+		return m
+	}
+	m1, m2 := build(), build()
+	assert.Equal(uint64(1), m1.Reseeds())
+	assert.True(m1.Deterministic())
+	assert.Equal(layout(m1), layout(m2))
+
+	// WithHash取消确定性模式
+	m := NewHMap(0, WithSeed(1), WithHashName("xxh64"))
+	assert.False(m.Deterministic())
+}
+
+// 每个正常桶及其溢出桶中的key，按槽位顺序
+func layout(m *hmap) [][]string {
+	m.finishGrow()
+	var buckets [][]string
+	for _, bm := range m.buckets {
+		var keys []string
+		for b := bm; b != nil; b = b.overflow {
+			for i := 0; i < 8; i++ {
+				if !isEmpty(b.tophash[i]) {
+					keys = append(keys, b.keys[i])
+				}
+			}
+		}
+		buckets = append(buckets, keys)
+	}
+	return buckets
+}
+
+func rangeKeys(m *hmap) []string {
+	var keys []string
+	m.Range(func(key string, val interface{}) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+const goldenSnapshotCRC = 0x2144df1c
@@ -0,0 +1,320 @@
+package v2
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// WAL的sync策略
+type SyncPolicy int
+
+const (
+	SyncAlways   SyncPolicy = iota // 每次Set，Delete后sync
+	SyncInterval                   // 每隔SyncInterval在后台sync
+	SyncNever                      // 只在切换段，Checkpoint和Close时sync
+)
+
+type DurableOptions struct {
+	FS           FS            // 默认使用os
+	Sync         SyncPolicy    // 默认SyncAlways
+	SyncInterval time.Duration // SyncInterval策略的间隔，默认100ms
+	SegmentSize  int64         // 单个WAL段的大小上限，默认64MB
+	Codec        Codec         // val的编解码，默认gob
+	Cap          int           // map的预设容量
+}
+
+// 持久化的map，每次Set，Delete先追加到WAL，再修改内存中的hmap
+// 打开时加载最新的快照，再重放快照之后的WAL
+// Checkpoint写入新的快照，删除旧的快照和WAL段
+// 并发安全
+type DurableMap struct {
+	mu      sync.Mutex
+	hm      *hmap
+	wal     *wal
+	policy  SyncPolicy
+	syncErr error // 后台sync的错误，在下一次写入时返回
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func OpenDurableMap(dir string, opts *DurableOptions) (*DurableMap, error) {
+	var o DurableOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.FS == nil {
+		o.FS = osFS{}
+	}
+	if o.SyncInterval <= 0 {
+		o.SyncInterval = 100 * time.Millisecond
+	}
+	if o.SegmentSize <= 0 {
+		o.SegmentSize = defaultSegment
+	}
+	if o.Cap < 0 || o.Cap > 1<<30 {
+		panic("cap error")
+	}
+	if err := o.FS.MkdirAll(dir); err != nil {
+		return nil, err
+	}
+	w := &wal{fs: o.FS, dir: dir, segmentSize: o.SegmentSize}
+	hm := makemap(uint(o.Cap))
+	hm.SetCodec(o.Codec)
+	if err := w.recover(hm); err != nil {
+		return nil, err
+	}
+
+	dm := &DurableMap{hm: hm, wal: w, policy: o.Sync}
+	if o.Sync == SyncInterval {
+		dm.stop = make(chan struct{})
+		dm.done = make(chan struct{})
+		go dm.syncLoop(o.SyncInterval)
+	}
+	return dm, nil
+}
+
+// 加载最新的快照，重放之后的WAL段，打开最后一段用于追加
+// 最后一段末尾不完整的记录是写入时崩溃留下的，直接截断
+// 其他段中的错误记录返回ErrWALCorrupt
+func (w *wal) recover(hm *hmap) error {
+	segments, snapshots, err := listWAL(w.fs, w.dir)
+	if err != nil {
+		return err
+	}
+	var base uint64
+	if len(snapshots) > 0 {
+		base = snapshots[len(snapshots)-1]
+		if err := w.loadSnapshot(hm, base); err != nil {
+			return err
+		}
+	}
+
+	seq, size := base, int64(0)
+	for i, s := range segments {
+		if s < base {
+			// Checkpoint在删除旧段之前崩溃
+			if err := w.fs.Remove(w.segmentName(s)); err != nil {
+				return err
+			}
+			continue
+		}
+		var applyErr error
+		valid, total, err := readSegment(w.fs, w.segmentName(s), func(rec walRecord) {
+			if applyErr == nil {
+				applyErr = applyWALRecord(hm, rec)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		if applyErr != nil {
+			return applyErr
+		}
+		if valid < total {
+			if i != len(segments)-1 {
+				return fmt.Errorf("%w: %s at offset %d", ErrWALCorrupt, w.segmentName(s), valid)
+			}
+			if err := w.truncateSegment(s, valid); err != nil {
+				return err
+			}
+		}
+		seq, size = s, valid
+	}
+	return w.openSegment(seq, size)
+}
+
+func (w *wal) loadSnapshot(hm *hmap, seq uint64) error {
+	f, err := w.fs.OpenFile(w.snapshotName(seq), os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = hm.ReadFrom(f)
+	return err
+}
+
+func (w *wal) truncateSegment(seq uint64, size int64) error {
+	f, err := w.fs.OpenFile(w.segmentName(seq), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	err = f.Truncate(size)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func applyWALRecord(hm *hmap, rec walRecord) error {
+	switch rec.op {
+	case walSet:
+		val, err := hm.codec.Decode(rec.val)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrWALCorrupt, err)
+		}
+		hm.Set(rec.key, val)
+	case walDelete:
+		hm.Delete(rec.key)
+	}
+	return nil
+}
+
+func (dm *DurableMap) Set(key string, val interface{}) error {
+	data, err := dm.hm.codec.Encode(val)
+	if err != nil {
+		return err
+	}
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	if err := dm.log(walRecord{op: walSet, key: key, val: data}); err != nil {
+		return err
+	}
+	dm.hm.Set(key, val)
+	return nil
+}
+
+func (dm *DurableMap) Get(key string) (interface{}, bool) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	return dm.hm.Get(key)
+}
+
+// 删除不存在的key不写WAL
+func (dm *DurableMap) Delete(key string) error {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	if _, ok := dm.hm.Get(key); !ok {
+		return nil
+	}
+	if err := dm.log(walRecord{op: walDelete, key: key}); err != nil {
+		return err
+	}
+	dm.hm.Delete(key)
+	return nil
+}
+
+func (dm *DurableMap) Count() int {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	return dm.hm.Count()
+}
+
+// 遍历时持有锁，f中不能调用DurableMap的方法
+func (dm *DurableMap) Range(f func(key string, val interface{}) bool) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.hm.Range(f)
+}
+
+// 追加一条记录，按策略sync
+// SyncAlways时sync失败会截断这条记录，返回错误，不修改内存中的hmap
+func (dm *DurableMap) log(rec walRecord) error {
+	if err := dm.syncErr; err != nil {
+		dm.syncErr = nil
+		return err
+	}
+	if dm.policy == SyncAlways {
+		return dm.wal.appendSync(rec)
+	}
+	return dm.wal.append(rec)
+}
+
+// 立即将WAL写入磁盘
+func (dm *DurableMap) Sync() error {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	if dm.wal.file == nil {
+		return ErrWALClosed
+	}
+	return dm.wal.sync()
+}
+
+func (dm *DurableMap) syncLoop(interval time.Duration) {
+	defer close(dm.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-dm.stop:
+			return
+		case <-ticker.C:
+			dm.mu.Lock()
+			if err := dm.wal.sync(); err != nil && dm.syncErr == nil {
+				dm.syncErr = err
+			}
+			dm.mu.Unlock()
+		}
+	}
+}
+
+// 切换到新的WAL段，将当前的map写入该段对应的快照，再删除旧的快照和WAL段
+// 快照先写入临时文件，sync后重命名，崩溃时不会留下不完整的快照
+func (dm *DurableMap) Checkpoint() error {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	w := dm.wal
+	if w.file == nil {
+		return ErrWALClosed
+	}
+	if err := w.rotate(); err != nil {
+		return err
+	}
+	seq := w.seq
+	name := w.snapshotName(seq)
+	f, err := w.fs.OpenFile(name+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = dm.hm.WriteTo(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := w.fs.Rename(name+".tmp", name); err != nil {
+		return err
+	}
+
+	segments, snapshots, err := listWAL(w.fs, w.dir)
+	if err != nil {
+		return err
+	}
+	for _, s := range snapshots {
+		if s < seq {
+			err = errors.Join(err, w.fs.Remove(w.snapshotName(s)))
+		}
+	}
+	for _, s := range segments {
+		if s < seq {
+			err = errors.Join(err, w.fs.Remove(w.segmentName(s)))
+		}
+	}
+	return err
+}
+
+// 停止后台sync，sync并关闭WAL
+func (dm *DurableMap) Close() error {
+	if dm.stop != nil {
+		close(dm.stop)
+		<-dm.done
+		dm.stop = nil
+	}
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	err := dm.wal.close()
+	if dm.syncErr != nil && err == nil {
+		err = dm.syncErr
+	}
+	dm.syncErr = nil
+	return err
+}
@@ -0,0 +1,458 @@
+package v2
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 内存文件系统，测试用
+type memFS struct {
+	mu    sync.Mutex
+	files map[string]*memData
+}
+
+type memData struct {
+	data []byte
+}
+
+func newMemFS() *memFS {
+	return &memFS{files: make(map[string]*memData)}
+}
+
+func (fs *memFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	d, ok := fs.files[name]
+	if !ok {
+		if flag&os.O_CREATE == 0 {
+			return nil, os.ErrNotExist
+		}
+		d = &memData{}
+		fs.files[name] = d
+	}
+	if flag&os.O_TRUNC != 0 {
+		d.data = nil
+	}
+	return &memFile{fs: fs, d: d}, nil
+}
+
+func (fs *memFS) Remove(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, ok := fs.files[name]; !ok {
+		return os.ErrNotExist
+	}
+	delete(fs.files, name)
+	return nil
+}
+
+func (fs *memFS) Rename(oldname, newname string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	d, ok := fs.files[oldname]
+	if !ok {
+		return os.ErrNotExist
+	}
+	delete(fs.files, oldname)
+	fs.files[newname] = d
+	return nil
+}
+
+func (fs *memFS) MkdirAll(dir string) error {
+	return nil
+}
+
+func (fs *memFS) ReadDir(dir string) ([]string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	var names []string
+	for name := range fs.files {
+		if path.Dir(name) == dir {
+			names = append(names, path.Base(name))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// 文件内容的副本
+func (fs *memFS) read(name string) []byte {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]byte(nil), fs.files[name].data...)
+}
+
+// 读从头开始，写总是追加到末尾
+type memFile struct {
+	fs  *memFS
+	d   *memData
+	off int
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.off >= len(f.d.data) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.d.data[f.off:])
+	f.off += n
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	f.d.data = append(f.d.data, p...)
+	return len(p), nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	f.d.data = f.d.data[:size]
+	return nil
+}
+
+func (f *memFile) Sync() error  { return nil }
+func (f *memFile) Close() error { return nil }
+
+var errCrash = errors.New("crash")
+
+// 写入budget字节后模拟崩溃，之后所有的写操作都失败
+type crashFS struct {
+	*memFS
+	budget  int
+	written int
+	crashed bool
+}
+
+func (fs *crashFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if fs.crashed && flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE) != 0 {
+		return nil, errCrash
+	}
+	f, err := fs.memFS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &crashFile{File: f, fs: fs}, nil
+}
+
+func (fs *crashFS) Remove(name string) error {
+	if fs.crashed {
+		return errCrash
+	}
+	return fs.memFS.Remove(name)
+}
+
+func (fs *crashFS) Rename(oldname, newname string) error {
+	if fs.crashed {
+		return errCrash
+	}
+	return fs.memFS.Rename(oldname, newname)
+}
+
+type crashFile struct {
+	File
+	fs *crashFS
+}
+
+func (f *crashFile) Write(p []byte) (int, error) {
+	if f.fs.crashed {
+		return 0, errCrash
+	}
+	if f.fs.written+len(p) > f.fs.budget {
+		n := f.fs.budget - f.fs.written
+		f.File.Write(p[:n])
+		f.fs.written += n
+		f.fs.crashed = true
+		return n, errCrash
+	}
+	f.fs.written += len(p)
+	return f.File.Write(p)
+}
+
+func (f *crashFile) Sync() error {
+	if f.fs.crashed {
+		return errCrash
+	}
+	return f.File.Sync()
+}
+
+func (f *crashFile) Truncate(size int64) error {
+	if f.fs.crashed {
+		return errCrash
+	}
+	return f.File.Truncate(size)
+}
+
+func durableContent(dm *DurableMap) map[string]interface{} {
+	m := make(map[string]interface{})
+	dm.Range(func(key string, val interface{}) bool {
+		m[key] = val
+		return true
+	})
+	return m
+}
+
+// 测试写入，Checkpoint，重新打开
+func TestDurable1(t *testing.T) {
+	assert := assert.New(t)
+	fs := newMemFS()
+	opts := &DurableOptions{FS: fs, SegmentSize: 256}
+	dm, err := OpenDurableMap("db", opts)
+	assert.Nil(err)
+	for i := 0; i < 100; i++ {
+		assert.Nil(dm.Set(strconv.Itoa(i), i))
+	}
+	for i := 0; i < 100; i += 2 {
+		assert.Nil(dm.Delete(strconv.Itoa(i)))
+	}
+	assert.Nil(dm.Delete("x"))
+	assert.Nil(dm.Close())
+	segments, snapshots, _ := listWAL(fs, "db")
+	assert.Greater(len(segments), 1)
+	assert.Len(snapshots, 0)
+
+	dm, err = OpenDurableMap("db", opts)
+	assert.Nil(err)
+	assert.Equal(50, dm.Count())
+	for i := 0; i < 100; i++ {
+		val, ok := dm.Get(strconv.Itoa(i))
+		assert.Equal(i%2 == 1, ok, i)
+		if ok {
+			assert.Equal(i, val)
+		}
+	}
+
+	assert.Nil(dm.Checkpoint())
+	segments, snapshots, _ = listWAL(fs, "db")
+	assert.Len(segments, 1)
+	assert.Equal([]uint64{segments[0]}, snapshots)
+	assert.Nil(dm.Set("a", "啊"))
+	assert.Nil(dm.Close())
+
+	dm, err = OpenDurableMap("db", opts)
+	assert.Nil(err)
+	assert.Equal(51, dm.Count())
+	val, _ := dm.Get("a")
+	assert.Equal("啊", val)
+	assert.Nil(dm.Close())
+}
+
+// 测试末尾不完整的记录被截断，之后的写入可以正常重放
+func TestDurableTornTail(t *testing.T) {
+	assert := assert.New(t)
+	fs := newMemFS()
+	dm, err := OpenDurableMap("db", &DurableOptions{FS: fs})
+	assert.Nil(err)
+	assert.Nil(dm.Set("a", 1))
+	assert.Nil(dm.Set("b", 2))
+	assert.Nil(dm.Close())
+
+	name := "db/" + "wal-0000000000000000.log"
+	data := fs.read(name)
+	fs.files[name].data = data[:len(data)-3]
+	dm, err = OpenDurableMap("db", &DurableOptions{FS: fs})
+	assert.Nil(err)
+	assert.Equal(1, dm.Count())
+	assert.Nil(dm.Set("c", 3))
+	assert.Nil(dm.Close())
+
+	dm, err = OpenDurableMap("db", &DurableOptions{FS: fs})
+	assert.Nil(err)
+	assert.Equal(map[string]interface{}{"a": 1, "c": 3}, durableContent(dm))
+	assert.Nil(dm.Close())
+}
+
+// 测试中间段损坏时返回错误
+func TestDurableCorrupt(t *testing.T) {
+	assert := assert.New(t)
+	fs := newMemFS()
+	opts := &DurableOptions{FS: fs, SegmentSize: 64}
+	dm, err := OpenDurableMap("db", opts)
+	assert.Nil(err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(dm.Set(strconv.Itoa(i), i))
+	}
+	assert.Nil(dm.Close())
+
+	name := "db/" + "wal-0000000000000000.log"
+	fs.files[name].data[walHeader] ^= 0xff
+	_, err = OpenDurableMap("db", opts)
+	assert.True(errors.Is(err, ErrWALCorrupt), err)
+}
+
+// 测试在写入的每一个字节处崩溃，重新打开后的内容与所有成功的操作一致
+func TestDurableCrash(t *testing.T) {
+	assert := assert.New(t)
+	run := func(dm *DurableMap, model map[string]interface{}) {
+		for i := 0; i < 30; i++ {
+			key := strconv.Itoa(i % 12)
+			var err error
+			switch {
+			case i == 15:
+				err = dm.Checkpoint()
+			case i%5 == 4:
+				err = dm.Delete(key)
+				if err == nil {
+					delete(model, key)
+				}
+			default:
+				err = dm.Set(key, i)
+				if err == nil {
+					model[key] = i
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	opts := &DurableOptions{SegmentSize: 128}
+	full := &crashFS{memFS: newMemFS(), budget: 1 << 30}
+	opts.FS = full
+	dm, err := OpenDurableMap("db", opts)
+	assert.Nil(err)
+	run(dm, make(map[string]interface{}))
+	assert.Nil(dm.Close())
+	assert.Greater(full.written, 0)
+
+	for budget := 0; budget <= full.written; budget++ {
+		fs := newMemFS()
+		opts.FS = &crashFS{memFS: fs, budget: budget}
+		dm, err := OpenDurableMap("db", opts)
+		assert.Nil(err)
+		model := make(map[string]interface{})
+		run(dm, model)
+		dm.Close()
+
+		opts.FS = fs
+		dm, err = OpenDurableMap("db", opts)
+		if !assert.Nil(err, budget) {
+			continue
+		}
+		assert.Equal(model, durableContent(dm), budget)
+		assert.Nil(dm.Set("x", "x"))
+		assert.Nil(dm.Close())
+
+		dm, err = OpenDurableMap("db", opts)
+		assert.Nil(err, budget)
+		model["x"] = "x"
+		assert.Equal(model, durableContent(dm), budget)
+		assert.Nil(dm.Close())
+	}
+}
+
+// 测试后台定时sync
+func TestDurableSyncInterval(t *testing.T) {
+	assert := assert.New(t)
+	fs := &countSyncFS{memFS: newMemFS()}
+	dm, err := OpenDurableMap("db", &DurableOptions{FS: fs, Sync: SyncInterval, SyncInterval: time.Millisecond})
+	assert.Nil(err)
+	assert.Nil(dm.Set("a", 1))
+	assert.Eventually(func() bool {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		return fs.syncs > 0
+	}, time.Second, time.Millisecond)
+	assert.Nil(dm.Close())
+
+	fs = &countSyncFS{memFS: newMemFS()}
+	dm, err = OpenDurableMap("db", &DurableOptions{FS: fs, Sync: SyncNever})
+	assert.Nil(err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(dm.Set("a", i))
+	}
+	assert.Equal(0, fs.syncs)
+	assert.Nil(dm.Close())
+	assert.Equal(1, fs.syncs)
+
+	fs = &countSyncFS{memFS: newMemFS()}
+	dm, err = OpenDurableMap("db", &DurableOptions{FS: fs})
+	assert.Nil(err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(dm.Set("a", i))
+	}
+	assert.Equal(10, fs.syncs)
+	assert.Nil(dm.Close())
+}
+
+type countSyncFS struct {
+	*memFS
+	syncs int
+	err   error // 不为nil时sync返回该错误
+}
+
+func (fs *countSyncFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := fs.memFS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &countSyncFile{File: f, fs: fs}, nil
+}
+
+type countSyncFile struct {
+	File
+	fs *countSyncFS
+}
+
+func (f *countSyncFile) Sync() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	f.fs.syncs++
+	return f.fs.err
+}
+
+// SyncAlways时sync失败，截断这条记录，内存和重启后都没有该修改
+func TestDurableSyncError(t *testing.T) {
+	assert := assert.New(t)
+	errSync := errors.New("sync error")
+	fs := &countSyncFS{memFS: newMemFS()}
+	dm, err := OpenDurableMap("db", &DurableOptions{FS: fs})
+	assert.Nil(err)
+	assert.Nil(dm.Set("a", 1))
+	fs.mu.Lock()
+	fs.err = errSync
+	fs.mu.Unlock()
+	assert.Equal(errSync, dm.Set("b", 2))
+	assert.Equal(errSync, dm.Delete("a"))
+	assert.Equal(map[string]interface{}{"a": 1}, durableContent(dm))
+	fs.mu.Lock()
+	fs.err = nil
+	fs.mu.Unlock()
+	assert.Nil(dm.Set("c", 3))
+	assert.Nil(dm.Close())
+
+	dm, err = OpenDurableMap("db", &DurableOptions{FS: fs})
+	assert.Nil(err)
+	assert.Equal(map[string]interface{}{"a": 1, "c": 3}, durableContent(dm))
+	assert.Nil(dm.Close())
+}
+
+// 测试使用os文件系统
+func TestDurableOS(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	dm, err := OpenDurableMap(dir, nil)
+	assert.Nil(err)
+	assert.Nil(dm.Set("a", []byte("1")))
+	assert.Nil(dm.Checkpoint())
+	assert.Nil(dm.Set("b", 2))
+	assert.Nil(dm.Close())
+
+	dm, err = OpenDurableMap(dir, nil)
+	assert.Nil(err)
+	assert.Equal(map[string]interface{}{"a": []byte("1"), "b": 2}, durableContent(dm))
+	assert.Nil(dm.Close())
+}
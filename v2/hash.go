@@ -2,6 +2,8 @@ package v2
 
 import (
 	"hash/maphash"
+	"sort"
+	"sync"
 )
 
 type Hash interface {
@@ -9,26 +11,123 @@ type Hash interface {
 	Hash(string) uint64
 }
 
+// 不保存maphash.Hash的状态，可以并发调用
 type mapHash struct {
-	h *maphash.Hash
+	seed maphash.Seed
 }
 
 func newMapHash(seed maphash.Seed) *mapHash {
 	mh := &mapHash{
-		h: new(maphash.Hash),
+		seed: seed,
 	}
-	mh.h.SetSeed(seed)
 	return mh
 }
 
 func (hash *mapHash) Seed() maphash.Seed {
-	return hash.h.Seed()
+	return hash.seed
 }
 
 func (hash *mapHash) Hash(key string) uint64 {
-	hash.h.WriteString(key)
-	s := hash.h.Sum64()
-	// 清空缓存
-	hash.h.Reset()
-	return s
+	return maphash.String(hash.seed, key)
+}
+
+// 通过maphash种子创建Hash，带密钥的哈希函数从种子派生密钥
+type HashFunc func(seed maphash.Seed) Hash
+
+var (
+	hashMu    sync.RWMutex
+	hashFuncs = map[string]HashFunc{
+		"maphash": newMapHashFunc,
+		"fnv1a":   func(seed maphash.Seed) Hash { return &fnv1a{seed: seed} },
+		"xxh64": func(seed maphash.Seed) Hash {
+			return &xxh64{seed: seed, key: seedKey(seed, "xxh64")}
+		},
+		"wyhash": func(seed maphash.Seed) Hash {
+			return &wyhash{seed: seed, key: seedKey(seed, "wyhash")}
+		},
+		"siphash": func(seed maphash.Seed) Hash {
+			return &sipHash{seed: seed, k0: seedKey(seed, "siphash0"), k1: seedKey(seed, "siphash1")}
+		},
+	}
+)
+
+// 按名字注册哈希函数，名字重复时panic
+func RegisterHash(name string, f HashFunc) {
+	hashMu.Lock()
+	defer hashMu.Unlock()
+	if f == nil {
+		panic("hash func is nil")
+	}
+	if _, ok := hashFuncs[name]; ok {
+		panic("hash " + name + " already registered")
+	}
+	hashFuncs[name] = f
+}
+
+// 按名字查找哈希函数，内置maphash，fnv1a，xxh64，wyhash，siphash
+func LookupHash(name string) (HashFunc, bool) {
+	hashMu.RLock()
+	defer hashMu.RUnlock()
+	f, ok := hashFuncs[name]
+	return f, ok
+}
+
+// 所有已注册的哈希函数名字，按字母排序
+func HashNames() []string {
+	hashMu.RLock()
+	defer hashMu.RUnlock()
+	names := make([]string, 0, len(hashFuncs))
+	for name := range hashFuncs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 哈希函数的标识，KeyHash通过比较标识判断哈希值是否由同一个哈希函数计算
+// 不直接比较Hash，Hash的实现不一定可以比较
+// 不能是空结构体，空结构体的指针可能相等
+type hashID struct {
+	_ byte
+}
+
+// 设置哈希函数，同时创建新的标识
+func (hm *hmap) setHash(h Hash) {
+	hm.mapHash = h
+	hm.hashID = new(hashID)
+}
+
+// NewHMap的选项
+type Option func(hm *hmap)
+
+func newMapHashFunc(seed maphash.Seed) Hash {
+	return newMapHash(seed)
+}
+
+// 使用f创建的哈希函数，默认为maphash，会取消WithSeed的确定性模式
+// f不使用种子时，链表过长也不重新设置种子
+func WithHash(f HashFunc) Option {
+	return func(hm *hmap) {
+		hm.setHash(f(hm.seed))
+		hm.hashFunc = f
+		hm.seedFunc = nil
+		hm.unkeyed = unkeyedHash(f)
+	}
+}
+
+// 探测哈希函数是否使用种子的key
+const probeKey = "hmap"
+
+// 用两个不同的种子计算同一个key，结果相同时认为f不使用种子，例如FNV-1a
+func unkeyedHash(f HashFunc) bool {
+	return f(maphash.MakeSeed()).Hash(probeKey) == f(maphash.MakeSeed()).Hash(probeKey)
+}
+
+// 使用按名字注册的哈希函数，名字不存在时panic
+func WithHashName(name string) Option {
+	f, ok := LookupHash(name)
+	if !ok {
+		panic("unknown hash " + name)
+	}
+	return WithHash(f)
 }
@@ -0,0 +1,71 @@
+package v2
+
+// 预先计算的哈希值，记录了计算它的哈希函数
+// 同一个key在多个共用哈希函数的map中查找时，只需要计算一次
+type KeyHash struct {
+	hash uint64
+	id   *hashID // 计算它的哈希函数的标识
+}
+
+func (kh KeyHash) Uint64() uint64 {
+	return kh.hash
+}
+
+// 使用map的哈希函数计算key的哈希值
+func (hm *hmap) HashKey(key string) KeyHash {
+	return KeyHash{hash: hm.mapHash.Hash(key), id: hm.hashID}
+}
+
+func (hm *hmap) HashKeyBytes(key []byte) KeyHash {
+	return KeyHash{hash: hm.hashBytes(key), id: hm.hashID}
+}
+
+// 与other共用种子和哈希函数，HashKey的结果在两个map中通用
+// 其中一个map重新设置种子后不再共用，之前计算的哈希值在该map中会重新计算
+func WithHashOf(other *hmap) Option {
+	return func(hm *hmap) {
+		hm.seed = other.seed
+		hm.mapHash = other.mapHash
+		hm.hashID = other.hashID
+		hm.hashFunc = other.hashFunc
+		hm.seedFunc = other.seedFunc
+		hm.rng = other.rng
+		hm.unkeyed = other.unkeyed
+	}
+}
+
+// 是否与other使用同一个哈希函数
+func (hm *hmap) SameHash(other *hmap) bool {
+	return hm.hashID == other.hashID
+}
+
+func (hm *hmap) GetHashed(key string, kh KeyHash) (interface{}, bool) {
+	return hm.lookup(key, hm.checkHash(key, kh))
+}
+
+func (hm *hmap) SetHashed(key string, val interface{}, kh KeyHash) {
+	if hm.assign(key, val, hm.checkHash(key, kh)) {
+		hm.count++
+		hm.checkFlood()
+	}
+}
+
+func (hm *hmap) DeleteHashed(key string, kh KeyHash) {
+	if hm.remove(key, hm.checkHash(key, kh)) {
+		hm.count--
+	}
+}
+
+// 不同哈希函数计算的哈希值放错桶，重新计算并记录次数
+func (hm *hmap) checkHash(key string, kh KeyHash) uint64 {
+	if kh.id == hm.hashID {
+		return kh.hash
+	}
+	hm.hashMismatches++
+	return hm.mapHash.Hash(key)
+}
+
+// GetHashed等收到其他哈希函数计算的哈希值的次数
+func (hm *hmap) HashMismatches() uint64 {
+	return hm.hashMismatches
+}
@@ -0,0 +1,200 @@
+package v2
+
+import (
+	"hash/maphash"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试多个map共用哈希函数
+func TestHashed1(t *testing.T) {
+	assert := assert.New(t)
+	m1 := NewHMap(0, WithHashName("siphash"))
+	m2 := NewHMap(0, WithHashOf(m1))
+	m3 := NewHMap(1<<10, WithHashOf(m1))
+	maps := []*hmap{m1, m2, m3}
+	for _, m := range maps {
+		assert.True(m.SameHash(m1))
+	}
+	count := 1 << 12
+	for i := 0; i < count; i++ {
+		key := strconv.Itoa(i)
+		kh := m1.HashKey(key)
+		assert.Equal(m2.mapHash.Hash(key), kh.Uint64())
+		for j, m := range maps {
+			m.SetHashed(key, i*j, kh)
+		}
+	}
+	for i := 0; i < count; i++ {
+		key := strconv.Itoa(i)
+		kh := m2.HashKeyBytes([]byte(key))
+		for j, m := range maps {
+			val, ok := m.GetHashed(key, kh)
+			assert.True(ok)
+			assert.Equal(i*j, val)
+			// 与普通的Get结果相同
+			val, _ = m.Get(key)
+			assert.Equal(i*j, val)
+		}
+	}
+	for i := 0; i < count; i += 2 {
+		key := strconv.Itoa(i)
+		kh := m3.HashKey(key)
+		for _, m := range maps {
+			m.DeleteHashed(key, kh)
+		}
+	}
+	for _, m := range maps {
+		assert.Equal(count/2, m.Count())
+		assert.Equal(uint64(0), m.HashMismatches())
+	}
+}
+
+// 测试不同种子计算的哈希值会被发现并重新计算，不会放错桶
+func TestHashedMismatch(t *testing.T) {
+	assert := assert.New(t)
+	m1 := NewHMap(0)
+	m2 := NewHMap(0)
+	assert.False(m1.SameHash(m2))
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		m2.SetHashed(key, i, m1.HashKey(key))
+	}
+	assert.Equal(uint64(100), m2.HashMismatches())
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		val, ok := m2.Get(key)
+		assert.True(ok)
+		assert.Equal(i, val)
+		val, ok = m2.GetHashed(key, m1.HashKey(key))
+		assert.True(ok)
+		assert.Equal(i, val)
+	}
+	m2.DeleteHashed("1", m1.HashKey("1"))
+	_, ok := m2.Get("1")
+	assert.False(ok)
+	assert.Equal(uint64(201), m2.HashMismatches())
+
+	// 相同的种子，不同的哈希函数
+	m3 := NewHMap(0, WithHashOf(m1), WithHashName("xxh64"))
+	assert.False(m3.SameHash(m1))
+	m3.SetHashed("a", 1, m1.HashKey("a"))
+	val, _ := m3.Get("a")
+	assert.Equal(1, val)
+	assert.Equal(uint64(1), m3.HashMismatches())
+}
+
+// 测试重新设置种子后，之前计算的哈希值仍然安全
+func TestHashedReseed(t *testing.T) {
+	assert := assert.New(t)
+	m1 := NewHMap(0)
+	m2 := NewHMap(0, WithHashOf(m1))
+	kh := m1.HashKey("a")
+	m2.Set("a", 1)
+	m2.reseed(m1.seed)
+	assert.False(m2.SameHash(m1))
+	val, ok := m2.GetHashed("a", kh)
+	assert.True(ok)
+	assert.Equal(1, val)
+	assert.Equal(uint64(1), m2.HashMismatches())
+}
+
+// 不能比较的Hash实现
+type sliceHash struct {
+	seed maphash.Seed
+	salt []byte
+}
+
+func (h sliceHash) Seed() maphash.Seed {
+	return h.seed
+}
+
+func (h sliceHash) Hash(key string) uint64 {
+	return maphash.String(h.seed, string(h.salt)+key)
+}
+
+// 测试Hash的实现不能比较时，GetHashed和SameHash不会panic
+func TestHashedUncomparable(t *testing.T) {
+	assert := assert.New(t)
+	f := func(seed maphash.Seed) Hash {
+		return sliceHash{seed: seed, salt: []byte("salt")}
+	}
+	m1 := NewHMap(0, WithHash(f))
+	m2 := NewHMap(0, WithHashOf(m1))
+	m3 := NewHMap(0, WithHash(f))
+	assert.True(m2.SameHash(m1))
+	assert.False(m3.SameHash(m1))
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		kh := m1.HashKey(key)
+		m1.SetHashed(key, i, kh)
+		m2.SetHashed(key, i, kh)
+		m3.SetHashed(key, i, kh)
+	}
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		kh := m2.HashKey(key)
+		for _, m := range []*hmap{m1, m2, m3} {
+			val, ok := m.GetHashed(key, kh)
+			assert.True(ok)
+			assert.Equal(i, val)
+		}
+	}
+	assert.Equal(uint64(0), m2.HashMismatches())
+	assert.Equal(uint64(200), m3.HashMismatches())
+}
+
+// 测试GetHashed不分配内存
+func TestHashedAlloc(t *testing.T) {
+	assert := assert.New(t)
+	m1 := NewHMap(0)
+	m2 := NewHMap(0, WithHashOf(m1))
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		m1.Set(keys[i], i)
+		m2.Set(keys[i], i)
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		for _, key := range keys {
+			kh := m1.HashKey(key)
+			m1.GetHashed(key, kh)
+			m2.GetHashed(key, kh)
+		}
+	})
+	assert.Equal(float64(0), allocs)
+}
+
+func BenchmarkGetHashed(b *testing.B) {
+	maps := make([]*hmap, 12)
+	maps[0] = NewHMap(0)
+	for i := 1; i < len(maps); i++ {
+		maps[i] = NewHMap(0, WithHashOf(maps[0]))
+	}
+	keys := make([]string, 1<<12)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i) + "-some-longer-request-key"
+		for _, m := range maps {
+			m.Set(keys[i], i)
+		}
+	}
+	b.Run("Get", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			key := keys[i&(len(keys)-1)]
+			for _, m := range maps {
+				m.Get(key)
+			}
+		}
+	})
+	b.Run("GetHashed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			key := keys[i&(len(keys)-1)]
+			kh := maps[0].HashKey(key)
+			for _, m := range maps {
+				m.GetHashed(key, kh)
+			}
+		}
+	})
+}
@@ -0,0 +1,268 @@
+package v2
+
+import (
+	"hash/maphash"
+	"math/bits"
+)
+
+// 纯Go实现的哈希函数，都可以作为Hash使用
+// FNV-1a不带密钥，结果固定，xxh64，wyhash带64位种子，SipHash-2-4带128位密钥，适合不可信的key
+
+// 从maphash种子派生出固定的64位密钥，同一个种子得到相同的密钥
+func seedKey(seed maphash.Seed, name string) uint64 {
+	return maphash.String(seed, name)
+}
+
+// FNV-1a 64，不使用种子
+type fnv1a struct {
+	seed maphash.Seed
+}
+
+func NewFNV1a() Hash {
+	return &fnv1a{seed: maphash.MakeSeed()}
+}
+
+func (hash *fnv1a) Seed() maphash.Seed {
+	return hash.seed
+}
+
+func (hash *fnv1a) Hash(key string) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= prime64
+	}
+	return h
+}
+
+func (hash *fnv1a) HashBytes(b []byte) uint64 {
+	return hash.Hash(bytesView(b))
+}
+
+// xxHash64
+type xxh64 struct {
+	seed maphash.Seed
+	key  uint64
+}
+
+func NewXXH64(seed uint64) Hash {
+	return &xxh64{seed: maphash.MakeSeed(), key: seed}
+}
+
+func (hash *xxh64) Seed() maphash.Seed {
+	return hash.seed
+}
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+func (hash *xxh64) Hash(key string) uint64 {
+	seed := hash.key
+	n := len(key)
+	var h uint64
+	p := key
+	if n >= 32 {
+		v1 := seed + xxPrime1 + xxPrime2
+		v2 := seed + xxPrime2
+		v3 := seed
+		v4 := seed - xxPrime1
+		for len(p) >= 32 {
+			v1 = xxRound(v1, readU64(p, 0))
+			v2 = xxRound(v2, readU64(p, 8))
+			v3 = xxRound(v3, readU64(p, 16))
+			v4 = xxRound(v4, readU64(p, 24))
+			p = p[32:]
+		}
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = xxMergeRound(h, v1)
+		h = xxMergeRound(h, v2)
+		h = xxMergeRound(h, v3)
+		h = xxMergeRound(h, v4)
+	} else {
+		h = seed + xxPrime5
+	}
+	h += uint64(n)
+	for ; len(p) >= 8; p = p[8:] {
+		h ^= xxRound(0, readU64(p, 0))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(p) >= 4 {
+		h ^= uint64(readU32(p, 0)) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		p = p[4:]
+	}
+	for i := 0; i < len(p); i++ {
+		h ^= uint64(p[i]) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+func (hash *xxh64) HashBytes(b []byte) uint64 {
+	return hash.Hash(bytesView(b))
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxPrime1
+}
+
+func xxMergeRound(acc, val uint64) uint64 {
+	acc ^= xxRound(0, val)
+	return acc*xxPrime1 + xxPrime4
+}
+
+// wyhash final4，使用默认的secret
+type wyhash struct {
+	seed maphash.Seed
+	key  uint64
+}
+
+func NewWyHash(seed uint64) Hash {
+	return &wyhash{seed: maphash.MakeSeed(), key: seed}
+}
+
+func (hash *wyhash) Seed() maphash.Seed {
+	return hash.seed
+}
+
+var wyp = [4]uint64{0xa0761d6478bd642f, 0xe7037ed1a0b428db, 0x8ebc6af09c88c6e3, 0x589965cc75374cc3}
+
+func (hash *wyhash) Hash(key string) uint64 {
+	n := len(key)
+	p := key
+	seed := hash.key ^ wymix(hash.key^wyp[0], wyp[1])
+	var a, b uint64
+	if n <= 16 {
+		if n >= 4 {
+			a = uint64(readU32(p, 0))<<32 | uint64(readU32(p, n>>3<<2))
+			b = uint64(readU32(p, n-4))<<32 | uint64(readU32(p, n-4-n>>3<<2))
+		} else if n > 0 {
+			a = uint64(p[0])<<16 | uint64(p[n>>1])<<8 | uint64(p[n-1])
+		}
+	} else {
+		// off为当前读取的位置，最后16字节可能与已读取的部分重叠
+		i, off := n, 0
+		if i > 48 {
+			see1, see2 := seed, seed
+			for i > 48 {
+				seed = wymix(readU64(p, off)^wyp[1], readU64(p, off+8)^seed)
+				see1 = wymix(readU64(p, off+16)^wyp[2], readU64(p, off+24)^see1)
+				see2 = wymix(readU64(p, off+32)^wyp[3], readU64(p, off+40)^see2)
+				off += 48
+				i -= 48
+			}
+			seed ^= see1 ^ see2
+		}
+		for i > 16 {
+			seed = wymix(readU64(p, off)^wyp[1], readU64(p, off+8)^seed)
+			off += 16
+			i -= 16
+		}
+		a = readU64(p, off+i-16)
+		b = readU64(p, off+i-8)
+	}
+	a ^= wyp[1]
+	b ^= seed
+	b, a = bits.Mul64(a, b)
+	return wymix(a^wyp[0]^uint64(n), b^wyp[1])
+}
+
+func (hash *wyhash) HashBytes(b []byte) uint64 {
+	return hash.Hash(bytesView(b))
+}
+
+func wymix(a, b uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	return hi ^ lo
+}
+
+// SipHash-2-4，128位密钥
+type sipHash struct {
+	seed   maphash.Seed
+	k0, k1 uint64
+}
+
+func NewSipHash(k0, k1 uint64) Hash {
+	return &sipHash{seed: maphash.MakeSeed(), k0: k0, k1: k1}
+}
+
+func (hash *sipHash) Seed() maphash.Seed {
+	return hash.seed
+}
+
+func (hash *sipHash) Hash(key string) uint64 {
+	v0 := hash.k0 ^ 0x736f6d6570736575
+	v1 := hash.k1 ^ 0x646f72616e646f6d
+	v2 := hash.k0 ^ 0x6c7967656e657261
+	v3 := hash.k1 ^ 0x7465646279746573
+	round := func() {
+		v0 += v1
+		v1 = bits.RotateLeft64(v1, 13)
+		v1 ^= v0
+		v0 = bits.RotateLeft64(v0, 32)
+		v2 += v3
+		v3 = bits.RotateLeft64(v3, 16)
+		v3 ^= v2
+		v0 += v3
+		v3 = bits.RotateLeft64(v3, 21)
+		v3 ^= v0
+		v2 += v1
+		v1 = bits.RotateLeft64(v1, 17)
+		v1 ^= v2
+		v2 = bits.RotateLeft64(v2, 32)
+	}
+	n := len(key)
+	p := key
+	for ; len(p) >= 8; p = p[8:] {
+		m := readU64(p, 0)
+		v3 ^= m
+		round()
+		round()
+		v0 ^= m
+	}
+	last := uint64(n) << 56
+	for i := len(p) - 1; i >= 0; i-- {
+		last |= uint64(p[i]) << (8 * i)
+	}
+	v3 ^= last
+	round()
+	round()
+	v0 ^= last
+	v2 ^= 0xff
+	round()
+	round()
+	round()
+	round()
+	return v0 ^ v1 ^ v2 ^ v3
+}
+
+func (hash *sipHash) HashBytes(b []byte) uint64 {
+	return hash.Hash(bytesView(b))
+}
+
+func readU64(s string, i int) uint64 {
+	s = s[i : i+8]
+	return uint64(s[0]) | uint64(s[1])<<8 | uint64(s[2])<<16 | uint64(s[3])<<24 |
+		uint64(s[4])<<32 | uint64(s[5])<<40 | uint64(s[6])<<48 | uint64(s[7])<<56
+}
+
+func readU32(s string, i int) uint32 {
+	s = s[i : i+4]
+	return uint32(s[0]) | uint32(s[1])<<8 | uint32(s[2])<<16 | uint32(s[3])<<24
+}
@@ -0,0 +1,109 @@
+package v2
+
+import (
+	"hash/maphash"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试各哈希函数的标准测试向量
+func TestHashVectors(t *testing.T) {
+	assert := assert.New(t)
+	fnv := NewFNV1a()
+	assert.Equal(uint64(0xcbf29ce484222325), fnv.Hash(""))
+	assert.Equal(uint64(0xaf63dc4c8601ec8c), fnv.Hash("a"))
+	assert.Equal(uint64(0x85944171f73967e8), fnv.Hash("foobar"))
+
+	xxh := NewXXH64(0)
+	assert.Equal(uint64(0xef46db3751d8e999), xxh.Hash(""))
+	assert.Equal(uint64(0xd24ec4f1a98c6e5b), xxh.Hash("a"))
+	assert.Equal(uint64(0x44bc2cf5ad770999), xxh.Hash("abc"))
+	assert.Equal(uint64(0xcfe1f278fa89835c), xxh.Hash("abcdefghijklmnopqrstuvwxyz"))
+
+	wy := []struct {
+		seed uint64
+		key  string
+		hash uint64
+	}{
+		{0, "", 0x409638ee2bde459},
+		{1, "a", 0xa8412d091b5fe0a9},
+		{2, "abc", 0x32dd92e4b2915153},
+		{3, "message digest", 0x8619124089a3a16b},
+		{4, "abcdefghijklmnopqrstuvwxyz", 0x7a43afb61d7f5f40},
+		{5, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789", 0xff42329b90e50d58},
+		{6, strings.Repeat("1234567890", 8), 0xc39cab13b115aad3},
+	}
+	for _, v := range wy {
+		assert.Equal(v.hash, NewWyHash(v.seed).Hash(v.key), v.key)
+	}
+
+	// 密钥为00..0f，消息为00..0e
+	sip := NewSipHash(0x0706050403020100, 0x0f0e0d0c0b0a0908)
+	msg := make([]byte, 15)
+	for i := range msg {
+		msg[i] = byte(i)
+	}
+	assert.Equal(uint64(0x726fdb47dd0e0e31), sip.Hash(""))
+	assert.Equal(uint64(0xa129ca6149be45e5), sip.Hash(string(msg)))
+}
+
+// 测试注册表和NewHMap选项
+func TestHashRegistry(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{"fnv1a", "maphash", "siphash", "wyhash", "xxh64"}, HashNames())
+	_, ok := LookupHash("md5")
+	assert.False(ok)
+	assert.Panics(func() { WithHashName("md5") })
+	assert.Panics(func() { RegisterHash("xxh64", func(seed maphash.Seed) Hash { return nil }) })
+
+	for _, name := range HashNames() {
+		m := NewHMap(0, WithHashName(name))
+		for i := 0; i < 1<<12; i++ {
+			m.Set(strconv.Itoa(i), i)
+		}
+		for i := 0; i < 1<<12; i++ {
+			val, ok := m.Get(strconv.Itoa(i))
+			assert.True(ok, name)
+			assert.Equal(i, val)
+			val, ok = m.GetBytes([]byte(strconv.Itoa(i)))
+			assert.True(ok, name)
+			assert.Equal(i, val)
+		}
+		assert.Equal(m.seed, m.mapHash.Seed())
+	}
+
+	// 同一个种子派生出相同的密钥，不同的种子密钥不同
+	f, _ := LookupHash("siphash")
+	m1, m2 := NewHMap(0), NewHMap(0)
+	assert.Equal(f(m1.seed).Hash("a"), f(m1.seed).Hash("a"))
+	assert.NotEqual(f(m1.seed).Hash("a"), f(m2.seed).Hash("a"))
+}
+
+// 测试所有长度下HashBytes与Hash相同
+func TestHashLengths(t *testing.T) {
+	assert := assert.New(t)
+	hashes := []Hash{NewFNV1a(), NewXXH64(1), NewWyHash(1), NewSipHash(1, 2)}
+	buf := make([]byte, 0, 200)
+	for n := 0; n < 200; n++ {
+		for _, h := range hashes {
+			assert.Equal(h.Hash(string(buf)), h.(BytesHash).HashBytes(buf))
+		}
+		buf = append(buf, byte(n*7))
+	}
+}
+
+func BenchmarkHash(b *testing.B) {
+	key := strings.Repeat("k", 32)
+	for _, name := range HashNames() {
+		f, _ := LookupHash(name)
+		h := f(NewHMap(0).seed)
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				h.Hash(key)
+			}
+		})
+	}
+}
@@ -5,30 +5,48 @@ import (
 )
 
 type hmap struct {
-	count           uint    // map内所有元素个数
-	b               uint8   // 当前设置2^b为正常桶的个数
-	bucketCount     uint    // 桶的数量
-	buckets         []*bmap // 正常桶
-	overflowBuckets []*bmap // 溢出桶
-	// oldBuckets         []*bmap      // 正常桶，扩容时使用
-	// oldOverflowBuckets []*bmap      // 溢出桶，扩容时使用
-	cap       uint         // 初始化时，预设的map容量
-	mapHash   Hash         //hash函数
-	seed      maphash.Seed // 类似于hash0
-	noverflow uint16       // 大致的溢出桶个数
-
+	count              uint         // map内所有元素个数
+	b                  uint8        // 当前设置2^b为正常桶的个数
+	bucketCount        uint         // 桶的数量
+	buckets            []*bmap      // 正常桶
+	overflowBuckets    []*bmap      // 溢出桶
+	oldBuckets         []*bmap      // 正常桶，扩容时使用
+	oldOverflowBuckets []*bmap      // 溢出桶，扩容时使用
+	nevacuate          uint         // 迁移进度，小于nevacuate的旧桶都已迁移完成
+	shrinking          bool         // 当前是否为缩容
+	cap                uint         // 初始化时，预设的map容量
+	mapHash            Hash         //hash函数
+	seed               maphash.Seed // 类似于hash0
+	noverflow          uint16       // 大致的溢出桶个数
+	codec              Codec        // 快照中val的编解码
+	hashFunc           HashFunc     // 创建mapHash的函数，重新设置种子时使用，为nil时不重新设置
+	chain              int          // 最近一次新增元素所在链表的长度
+	reseeds            uint64       // 重新设置种子的次数
+	reseedCount        uint         // 上次重新设置种子时的元素个数
+	onReseed           func(ReseedEvent)
+	seedFunc           SeedFunc // 确定性模式下创建mapHash的函数
+	rng                uint64   // 确定性模式下随机数的状态
+	hashMismatches     uint64   // 收到其他哈希函数计算的哈希值的次数
+	hashID             *hashID  // mapHash的标识，每次设置mapHash时重新创建，WithHashOf共用
+	rehash             bool     // 重新设置种子的迁移中，按新的mapHash重新计算哈希值
+	unkeyed            bool     // hashFunc或seedFunc不使用种子，重新设置种子没有作用
 }
 
-func NewHMap(cap int) *hmap {
+func NewHMap(cap int, opts ...Option) *hmap {
 	if cap < 0 || cap > 1<<30 {
 		panic("cap error")
 	}
-	return makemap(uint(cap))
+	hm := makemap(uint(cap))
+	for _, opt := range opts {
+		opt(hm)
+	}
+	return hm
 }
 
 func (hm *hmap) Set(key string, val interface{}) {
 	if hm.set(key, val) {
 		hm.count++
+		hm.checkFlood()
 	}
 }
 func (hm *hmap) Get(key string) (interface{}, bool) {
@@ -45,38 +63,158 @@ func (hm *hmap) Count() int {
 
 // 返回值表示是否属于新增
 func (hm *hmap) set(key string, val interface{}) bool {
-	if hm.testhashGrow() {
-		hm.hashGrow()
+	return hm.assign(key, val, hm.mapHash.Hash(key))
+}
+func (hm *hmap) get(key string) (interface{}, bool) {
+	return hm.lookup(key, hm.mapHash.Hash(key))
+}
+func (hm *hmap) del(key string) bool {
+	return hm.remove(key, hm.mapHash.Hash(key))
+}
+
+// 通过已计算的hash插入或更新，返回值表示是否属于新增
+func (hm *hmap) assign(key string, val interface{}, hash uint64) bool {
+	return hm.assignKey(key, val, hash, false)
+}
+
+// copyKey为true时，只在新增时复制key
+func (hm *hmap) assignKey(key string, val interface{}, hash uint64, copyKey bool) bool {
+	if hm.buckets == nil {
+		hm.buckets = bmapSliceMake(hm.b)
 	}
 
-	hash := hm.mapHash.Hash(key)
+again:
 	bucketIndex := calbucket(hash, hm.b)
+	if hm.growing() {
+		hm.growWork(bucketIndex)
+	}
 	bm := hm.buckets[bucketIndex]
 	// 先从正常桶和溢出桶查找
 	// 如果找到了，就直接更新
 	bucket, index, ok := bm.getIndex(key, hash)
 	if ok {
 		bucket.vals[index] = val
-		return true
+		return false
+	}
+
+	// 新增元素前判断是否需要扩容，扩容中不再触发新的扩容
+	// 扩容后桶的位置可能变化，需要重新计算
+	if !hm.growing() && hm.testhashGrow() {
+		hm.hashGrow()
+		goto again
+	}
+
+	hm.chain = hm.insert(bm, cloneKey(key, copyKey), val, hash)
+	return true
+}
+
+// 通过已计算的hash查找
+func (hm *hmap) lookup(key string, hash uint64) (interface{}, bool) {
+	if hm.buckets == nil {
+		return nil, false
+	}
+	return hm.bucket(hash).get(key, hash)
+}
+
+// 通过已计算的hash删除，返回值表示是否删除成功
+func (hm *hmap) remove(key string, hash uint64) bool {
+	if hm.buckets == nil {
+		return false
+	}
+	bucketIndex := calbucket(hash, hm.b)
+	if hm.growing() {
+		hm.growWork(bucketIndex)
+	}
+	if !hm.buckets[bucketIndex].del(key, hash) {
+		return false
+	}
+	hm.unlinkEmptyOverflow(bucketIndex)
+
+	// 删除后判断是否需要缩容，扩容中不再触发
+	if !hm.growing() && hm.testShrink(hm.count-1) {
+		hm.startGrow(hm.b - 1)
+	}
+	return true
+}
+
+// 将正常桶bucketIndex之后的空溢出桶从链表中移除
+// 被移除的溢出桶保留overflow指针，正在遍历它的迭代器仍能继续遍历
+func (hm *hmap) unlinkEmptyOverflow(bucketIndex uint64) {
+	pre := hm.buckets[bucketIndex]
+	for overflow := pre.overflow; overflow != nil; overflow = overflow.overflow {
+		if overflow.count > 0 {
+			pre = overflow
+			continue
+		}
+		pre.overflow = overflow.overflow
+		if hm.noverflow > 0 {
+			hm.noverflow--
+		}
 	}
-	// 没有找到，将值插入一个空闲处
+	// 被移除的溢出桶较多时，从overflowBuckets中清理掉，释放内存
+	if uint(len(hm.overflowBuckets)) > 2*uint(hm.noverflow)+8 {
+		overflowBuckets := make([]*bmap, 0, hm.noverflow)
+		for _, overflow := range hm.overflowBuckets {
+			if overflow.count > 0 {
+				overflowBuckets = append(overflowBuckets, overflow)
+			}
+		}
+		hm.overflowBuckets = overflowBuckets
+		hm.noverflow = uint16(len(overflowBuckets))
+	}
+}
+
+// 缩容到合适的大小，一次性完成
+// 先完成正在进行的扩容，再将b减半直到装载因子接近6.5，并将元素重新紧密插入
+// 即使b不变，也会等量重建，清理溢出桶
+func (hm *hmap) ShrinkToFit() {
+	if hm.buckets == nil {
+		return
+	}
+	hm.finishGrow()
+	B := hm.b
+	for B > 0 && !overLoadFactor(hm.count, 1<<(B-1)) {
+		B--
+	}
+	hm.startGrow(B)
+	hm.finishGrow()
+}
+
+// 查找hash所在的正常桶
+// 扩容中，如果对应的旧桶还未迁移，则返回旧桶
+func (hm *hmap) bucket(hash uint64) *bmap {
+	if hm.growing() {
+		oldbm := hm.oldBuckets[hash&hm.oldbucketmask()]
+		if !oldbm.evacuated() {
+			return oldbm
+		}
+	}
+	return hm.buckets[calbucket(hash, hm.b)]
+}
+
+// 将key，val插入正常桶bm或其溢出桶的空闲处
+// 如果都满了，就创建一个新的溢出桶
+// 返回插入位置在链表中是第几个桶
+func (hm *hmap) insert(bm *bmap, key string, val interface{}, hash uint64) int {
 	// 先从正常桶插入
 	b := bm
-	index, ok = bmapGetFree(b)
+	index, ok := bmapGetFree(b)
 	if ok {
 		b.update(index, key, val, hash)
 		b.count++
-		return true
+		return 1
 	}
 	// 再找溢出桶
+	chain := 1
 	pre := b
 	overflow := b.overflow
 	for overflow != nil {
+		chain++
 		index, ok = bmapGetFree(overflow)
 		if ok {
 			overflow.update(index, key, val, hash)
 			overflow.count++
-			return true
+			return chain
 		}
 		pre = overflow
 		overflow = overflow.overflow
@@ -85,136 +223,120 @@ func (hm *hmap) set(key string, val interface{}) bool {
 	// 如果溢出桶也满了，就创建一个新的溢出桶
 	overflow = bmapInit()
 
-	overflow.update(index, key, val, hash)
+	overflow.update(0, key, val, hash)
 	overflow.count++
 	pre.overflow = overflow
 	hm.overflowBuckets = append(hm.overflowBuckets, overflow)
 	hm.incrnoverflow()
-
-	return true
-}
-func (hm *hmap) get(key string) (interface{}, bool) {
-	hash := hm.mapHash.Hash(key)
-	bucketIndex := calbucket(hash, hm.b)
-	bucket := hm.buckets[bucketIndex]
-	return bucket.get(key, hash)
-}
-func (hm *hmap) del(key string) bool {
-	hash := hm.mapHash.Hash(key)
-	bucketIndex := calbucket(hash, hm.b)
-	bucket := hm.buckets[bucketIndex]
-	return bucket.del(key, hash)
+	return chain + 1
 }
 
-// 等量扩容，一次性分配
-// 正常桶容量不变，将原本正常桶及其溢出桶，重新插入新的正常桶+溢出桶中，使key，val更紧密
-// 触发条件，溢出桶太多
-func (hm *hmap) sameSizeGrow() {
-	oldbuckets := hm.buckets
+// 装载因子大于6.5时翻倍扩容，将原本buckets[i]，分流到newBuckets[i]和newBuckets[i+(1<<oldb)]上
+// 溢出桶太多时等量扩容，将原本正常桶及其溢出桶，重新插入新的正常桶+溢出桶中，使key，val更紧密
+func (hm *hmap) hashGrow() {
 	B := hm.b
+	if overLoadFactor(hm.count+1, hm.bucketCount) {
+		// 翻倍扩容
+		B++
+	}
+	hm.startGrow(B)
+}
+
+// 开始扩容或缩容，只分配新桶，不迁移数据
+// 旧桶在之后的Set，Delete中逐步迁移，见growWork
+// 缩容时将原本buckets[i]和buckets[i+(1<<newb)]，合并到newBuckets[i]上
+func (hm *hmap) startGrow(B uint8) {
+	hm.shrinking = B < hm.b
+	hm.oldBuckets = hm.buckets
+	hm.oldOverflowBuckets = hm.overflowBuckets
 	hm.buckets = bmapSliceMake(B)
 	hm.overflowBuckets = make([]*bmap, 0)
 	hm.noverflow = 0
-	// 原来的i->i
-	for i := 0; i < len(oldbuckets); i++ {
-		oldbm := oldbuckets[i]
-		newbm := hm.buckets[i]
-		for oldbm != nil {
-			for j := uint8(0); j < uint8(8); j++ {
-				if !bmapEmpty(oldbm, j) {
-					// 尝试找本桶空闲
-					index, ok := bmapGetFree(newbm)
-					if ok {
-						bmapcopy(oldbm, j, newbm, index)
-						newbm.count++
-						continue
-					}
-					// 如果本桶没有空闲，则找溢出桶
-					for newbm.overflow != nil {
-						index, ok = bmapGetFree(newbm.overflow)
-						if ok {
-							// 将旧bmap里的tophash,key,hash,val复制到新bmap里
-							bmapcopy(oldbm, j, newbm, index)
-							newbm.count++
-							continue
-						}
-					}
-					// 新bmap已满，创建新的溢出桶
-					newbmap := bmapInit()
-					newbm.overflow = newbmap
-					hm.overflowBuckets = append(hm.overflowBuckets, newbmap)
-					newbm = newbmap
-					hm.incrnoverflow()
-				}
-			}
-			oldbm = oldbm.overflow
-		}
+	hm.nevacuate = 0
+	hm.b = B
+	hm.bucketCount = 1 << B
+}
+
+// 是否正在扩容
+func (hm *hmap) growing() bool {
+	return hm.oldBuckets != nil
+}
+
+// 旧桶的个数
+func (hm *hmap) noldbuckets() uint {
+	return uint(len(hm.oldBuckets))
+}
+
+// 旧桶的掩码，hash&oldbucketmask即旧桶的位置
+func (hm *hmap) oldbucketmask() uint64 {
+	return uint64(hm.noldbuckets() - 1)
+}
+
+// 每次Set，Delete最多迁移三个旧桶
+// 先迁移即将使用的桶，再按顺序迁移一个，保证扩容一定会结束
+// 缩容时新桶对应两个旧桶，都需要迁移
+func (hm *hmap) growWork(bucketIndex uint64) {
+	if hm.shrinking {
+		hm.evacuate(uint(bucketIndex))
+		hm.evacuate(uint(bucketIndex) + hm.bucketCount)
+	} else {
+		hm.evacuate(uint(bucketIndex & hm.oldbucketmask()))
+	}
+	if hm.growing() {
+		hm.evacuate(hm.nevacuate)
 	}
 }
 
-// 翻倍扩容，一次性分配
-// 将原本buckets[i]，分流到newBuckets[i]和newBuckets[i+(1<<hm.b)]上
-// 触发条件，装载因子大于6.5
-func (hm *hmap) grow() {
-	oldbucktes := hm.buckets
-	// oldoverflow = hm.oldOverflowBuckets
-	B := hm.b + 1
+// 一次性完成正在进行的扩容
+func (hm *hmap) finishGrow() {
+	for hm.growing() {
+		hm.evacuate(hm.nevacuate)
+	}
+}
 
-	hm.buckets = bmapSliceMake(B)
-	hm.overflowBuckets = make([]*bmap, 0)
-	hm.noverflow = 0
-	// 原来的i->{i,i+2^b}
-	for i := 0; i < len(oldbucktes); i++ {
-		oldbm := oldbucktes[i]
-		newbm1 := hm.buckets[i]
-		newbm2 := hm.buckets[i+(1<<hm.b)]
-		for oldbm != nil {
+// 迁移旧桶oldbucket及其溢出桶
+// 迁移完成后旧桶的tophash标记为已迁移，Get时不再访问
+// 旧桶中的数据保留，迭代器可能仍在使用，扩容结束后随旧桶一起释放
+func (hm *hmap) evacuate(oldbucket uint) {
+	oldbm := hm.oldBuckets[oldbucket]
+	if !oldbm.evacuated() {
+		for ; oldbm != nil; oldbm = oldbm.overflow {
 			for j := uint8(0); j < 8; j++ {
-				if !bmapEmpty(oldbm, j) {
-					var newbm *bmap
-					// 由倒数第B位取决分流
-					// fmt.Printf("%b,%b\r\n", oldbm.keyhash[j], 1<<B)
-					if oldbm.keyhash[j]&(1<<B) == 0 {
-						newbm = newbm1
-					} else {
-						newbm = newbm2
-					}
-
-					// 尝试找本桶空闲
-					index, ok := bmapGetFree(newbm)
-					if ok {
-						// 将旧bmap里的tophash,key,hash,val复制到新bmap里
-						bmapcopy(oldbm, j, newbm, index)
-						newbm.count++
-						continue
-					}
-					// 如果本桶没有空闲，则找溢出桶
-					for newbm.overflow != nil {
-						index, ok = bmapGetFree(newbm.overflow)
-						if ok {
-							// 将旧bmap里的tophash,key,hash,val复制到新bmap里
-							bmapcopy(oldbm, j, newbm, index)
-							newbm.count++
-							continue
-						}
-					}
-					// 新bmap已满，创建新的溢出桶
-					newbmap := bmapInit()
-					newbm.overflow = newbmap
-					hm.overflowBuckets = append(hm.overflowBuckets, newbmap)
-					if oldbm.keyhash[j]&(1<<B) == 0 {
-						newbm1 = newbmap
-					} else {
-						newbm2 = newbmap
-					}
-					hm.incrnoverflow()
+				if bmapEmpty(oldbm, j) {
+					oldbm.tophash[j] = evacuatedEmpty
+					continue
+				}
+				// 新桶的位置由新的b决定，翻倍扩容时分流，缩容时合并
+				hash := oldbm.keyhash[j]
+				if hm.rehash {
+					hash = hm.mapHash.Hash(oldbm.keys[j])
+				}
+				dst := calbucket(hash, hm.b)
+				hm.insert(hm.buckets[dst], oldbm.keys[j], oldbm.vals[j], hash)
+				if dst == uint64(oldbucket) {
+					oldbm.tophash[j] = evacuatedX
+				} else {
+					oldbm.tophash[j] = evacuatedY
 				}
 			}
-			oldbm = oldbm.overflow
 		}
 	}
-	hm.b++
-	hm.bucketCount = 1 << hm.b
+	if oldbucket == hm.nevacuate {
+		hm.advanceEvacuationMark()
+	}
+}
+
+// 推进迁移进度，全部迁移完成后释放旧桶，结束扩容
+func (hm *hmap) advanceEvacuationMark() {
+	hm.nevacuate++
+	for hm.nevacuate < hm.noldbuckets() && hm.oldBuckets[hm.nevacuate].evacuated() {
+		hm.nevacuate++
+	}
+	if hm.nevacuate == hm.noldbuckets() {
+		hm.oldBuckets = nil
+		hm.oldOverflowBuckets = nil
+		hm.shrinking = false
+	}
 }
 
 // noverflow直接+1
@@ -228,16 +350,11 @@ func (hm *hmap) incrnoverflow() {
 func (hm *hmap) testhashGrow() bool {
 	return overLoadFactor(hm.count+1, hm.bucketCount) || testTooManyBuckets(hm.noverflow, hm.b)
 }
-func (hm *hmap) hashGrow() {
-	if overLoadFactor(hm.count+1, hm.bucketCount) {
-		// 翻倍扩容
-		hm.grow()
-
-	} else {
-		// 等量扩容
-		hm.sameSizeGrow()
-	}
 
+// 是否满足缩容条件
+// 装载因子低于6.5/4，且正常桶个数大于初始化时预设的个数
+func (hm *hmap) testShrink(count uint) bool {
+	return hm.b > capb(hm.cap) && underLoadFactor(count, hm.bucketCount)
 }
 
 // 是否满足翻倍扩容条件
@@ -247,6 +364,12 @@ func overLoadFactor(count uint, bucketCount uint) bool {
 	return count > bucketCount*13/2
 }
 
+// 是否满足缩容条件
+// 如果装载因子低于6.5/4，则返回true，缩容后装载因子低于3.25，不会马上再次扩容
+func underLoadFactor(count uint, bucketCount uint) bool {
+	return count < bucketCount*13/8
+}
+
 // 是否满足等量扩容条件
 // 如果b>15，返回noverflow>=1<<15
 // 如果b<=15，返回noverflow>=1<<b
@@ -260,22 +383,32 @@ func testTooManyBuckets(noverflow uint16, b uint8) bool {
 func makemap(cap uint) *hmap {
 	h := new(hmap)
 	h.cap = cap
-	B := uint8(0)
-	for overloadFactor(cap, B) {
-		B++
-	}
+	B := capb(cap)
 	h.b = B
+	// b为0时，第一次Set再分配
 	if h.b > 0 {
 		h.buckets = bmapSliceMake(B)
 	}
 	h.overflowBuckets = make([]*bmap, 0)
 	h.bucketCount = 1 << B
 	h.seed = maphash.MakeSeed()
-	hash := newMapHash(h.seed)
-	h.mapHash = hash
+	h.setHash(newMapHash(h.seed))
+	h.hashFunc = newMapHashFunc
+	h.codec = gobCodec{}
 	return h
 }
 
+// tophash中除了哈希值的高八位，还记录槽位的状态，与golang中相同
+// 小于minTopHash的值表示状态，哈希值的高八位小于minTopHash时加上minTopHash
+const (
+	emptyRest      = 0 // 槽位为空，且之后的槽位和溢出桶都为空
+	emptyOne       = 1 // 槽位为空
+	evacuatedX     = 2 // 槽位有效，已迁移到新桶中相同的位置
+	evacuatedY     = 3 // 槽位有效，已迁移到新桶中其他的位置
+	evacuatedEmpty = 4 // 槽位为空，所在的桶已迁移
+	minTopHash     = 5 // 正常的tophash最小值
+)
+
 type bmap struct {
 	count    uint8 // 有效元素个数
 	tophash  [8]uint8
@@ -293,32 +426,61 @@ func (bm *bmap) get(key string, hash uint64) (interface{}, bool) {
 	return nil, false
 }
 
+// bm为正常桶
+// 删除后如果之后的槽位都为空，则向前将连续的emptyOne改为emptyRest，查找时可以提前结束
 func (bm *bmap) del(key string, hash uint64) bool {
 	b, index, ok := bm.getIndex(key, hash)
-	if ok {
-		b.update(index, "", nil, 0)
-		b.count--
+	if !ok {
+		return false
+	}
+	b.update(index, "", nil, 0)
+	b.tophash[index] = emptyOne
+	b.count--
+
+	if index == 7 {
+		if b.overflow != nil && b.overflow.tophash[0] != emptyRest {
+			return true
+		}
+	} else if b.tophash[index+1] != emptyRest {
 		return true
 	}
-	return false
+	for {
+		b.tophash[index] = emptyRest
+		if index == 0 {
+			if b == bm {
+				break
+			}
+			// 找到前一个桶
+			c := b
+			for b = bm; b.overflow != c; b = b.overflow {
+			}
+			index = 7
+		} else {
+			index--
+		}
+		if b.tophash[index] != emptyOne {
+			break
+		}
+	}
+	return true
 }
 
 // 通过遍历正常桶与溢出桶查找
+// 遇到emptyRest说明之后都为空，提前结束
 func (bm *bmap) getIndex(key string, hash uint64) (*bmap, uint8, bool) {
-	b := bm
-	// 从正常桶搜索
-	index, ok := bmapSearch(bm, key, hash)
-	if ok {
-		return b, index, true
-	}
-	// 从溢出桶搜索
-	overflow := b.overflow
-	for overflow != nil && overflow.count > 0 {
-		index, ok := bmapSearch(overflow, key, hash)
-		if ok {
-			return overflow, index, true
+	tophash := calTopHash(hash)
+	for b := bm; b != nil; b = b.overflow {
+		for i := uint8(0); i < 8; i++ {
+			if b.tophash[i] != tophash {
+				if b.tophash[i] == emptyRest {
+					return nil, uint8(0), false
+				}
+				continue
+			}
+			if hash == b.keyhash[i] && key == b.keys[i] {
+				return b, i, true
+			}
 		}
-		overflow = overflow.overflow
 	}
 	return nil, uint8(0), false
 }
@@ -329,15 +491,10 @@ func (bm *bmap) update(index uint8, key string, val interface{}, hash uint64) {
 	bm.vals[index] = val
 }
 
-// 从桶中查询
-func bmapSearch(bm *bmap, key string, hash uint64) (uint8, bool) {
-	tophash := calTopHash(hash)
-	for i := 0; i < 8; i++ {
-		if tophash == bm.tophash[i] && hash == bm.keyhash[i] && key == bm.keys[i] {
-			return uint8(i), true
-		}
-	}
-	return uint8(0), false
+// 是否已迁移到新桶
+func (bm *bmap) evacuated() bool {
+	h := bm.tophash[0]
+	return h > emptyOne && h < minTopHash
 }
 
 // 从桶中找一个空闲处
@@ -355,7 +512,12 @@ func bmapGetFree(bm *bmap) (uint8, bool) {
 
 // 判断index是否为空
 func bmapEmpty(bm *bmap, index uint8) bool {
-	return bm.tophash[index] == 0 && bm.keyhash[index] == 0
+	return isEmpty(bm.tophash[index])
+}
+
+// 判断tophash是否表示空槽位
+func isEmpty(tophash uint8) bool {
+	return tophash <= emptyOne
 }
 
 func bmapSliceMake(b uint8) []*bmap {
@@ -375,12 +537,13 @@ func bmapInit() *bmap {
 	return bm
 }
 
-func bmapcopy(src *bmap, srcIndex uint8, dst *bmap, dstIndex uint8) {
-	dst.tophash[dstIndex] = src.tophash[srcIndex]
-	dst.keyhash[dstIndex] = src.keyhash[srcIndex]
-	dst.keys[dstIndex] = src.keys[srcIndex]
-	dst.vals[dstIndex] = src.vals[srcIndex]
-	// fmt.Println(dst.keys[dstIndex], src.keys[srcIndex])
+// 计算容量为cap时的b
+func capb(cap uint) uint8 {
+	B := uint8(0)
+	for overloadFactor(cap, B) {
+		B++
+	}
+	return B
 }
 
 // 计算cap是否大于2^b
@@ -394,6 +557,11 @@ func calbucket(hash uint64, b uint8) uint64 {
 }
 
 // 计算tophash，也就是hash值的高八位
+// 小于minTopHash的值用于表示状态，需要跳过
 func calTopHash(hash uint64) uint8 {
-	return uint8(hash >> 56)
+	top := uint8(hash >> 56)
+	if top < minTopHash {
+		top += minTopHash
+	}
+	return top
 }
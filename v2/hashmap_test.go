@@ -1,6 +1,7 @@
 package v2
 
 import (
+	"hash/maphash"
 	"strconv"
 	"testing"
 
@@ -241,3 +242,298 @@ func TestOverflow1(t *testing.T) {
 	// fmt.Println(m.count, 13*m.bucketCount/2)
 	m.Set(strconv.Itoa(count), count)
 }
+
+// 测试增量扩容，扩容中新旧桶都能查到
+func TestGrowIncremental(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(1 << 10)
+	count := 0
+	// 装载因子超过6.5，触发翻倍扩容
+	for !m.growing() {
+		m.Set(strconv.Itoa(count), count)
+		count++
+	}
+	assert.Equal(uint8(8), m.b)
+	assert.Equal(uint(1<<7), m.noldbuckets())
+	for i := 0; i < count; i++ {
+		val, ok := m.Get(strconv.Itoa(i))
+		assert.True(ok, i)
+		assert.Equal(i, val, i)
+	}
+	// 每次Set最多迁移两个旧桶
+	sets := 0
+	for m.growing() {
+		m.Set(strconv.Itoa(count), count)
+		count++
+		sets++
+	}
+	assert.GreaterOrEqual(sets, 1<<6)
+	assert.Nil(m.oldOverflowBuckets)
+	assert.Equal(count, m.Count())
+	for i := 0; i < count; i++ {
+		val, ok := m.Get(strconv.Itoa(i))
+		assert.True(ok, i)
+		assert.Equal(i, val, i)
+	}
+}
+
+// 测试扩容中Delete
+func TestGrowDelete(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(1 << 10)
+	count := 0
+	for !m.growing() {
+		m.Set(strconv.Itoa(count), count)
+		count++
+	}
+	for i := 0; i < count; i += 2 {
+		m.Delete(strconv.Itoa(i))
+	}
+	assert.Equal(count/2, m.Count())
+	for i := 0; i < count; i++ {
+		val, ok := m.Get(strconv.Itoa(i))
+		if i%2 == 0 {
+			assert.False(ok, i)
+		} else {
+			assert.True(ok, i)
+			assert.Equal(i, val, i)
+		}
+	}
+}
+
+// 测试重复Set不增加Count
+func TestSetCount(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(0)
+	m.Set("a", 1)
+	m.Set("a", 2)
+	assert.Equal(1, m.Count())
+	val, ok := m.Get("a")
+	assert.True(ok)
+	assert.Equal(2, val)
+}
+
+// 所有key哈希值相同，用于测试哈希冲突
+type collideHash struct {
+	seed maphash.Seed
+}
+
+func (hash collideHash) Seed() maphash.Seed {
+	return hash.seed
+}
+
+func (hash collideHash) Hash(key string) uint64 {
+	return 1
+}
+
+// 测试删除后自动缩容
+func TestShrink1(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(0)
+	count := 1 << 12
+	for i := 0; i < count; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	b := m.b
+	for i := 0; i < count-10; i++ {
+		m.Delete(strconv.Itoa(i))
+	}
+	// 删除不存在的key也会迁移旧桶，直到缩容完成
+	for m.growing() {
+		m.Delete(strconv.Itoa(0))
+	}
+	assert.Less(m.b, b)
+	assert.Equal(uint8(2), m.b)
+	assert.Equal(10, m.Count())
+	for i := 0; i < count; i++ {
+		val, ok := m.Get(strconv.Itoa(i))
+		if i < count-10 {
+			assert.False(ok, i)
+		} else {
+			assert.True(ok, i)
+			assert.Equal(i, val, i)
+		}
+	}
+}
+
+// 测试自动缩容不小于初始化时预设的容量
+func TestShrink2(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(1 << 10)
+	for i := 0; i < 1<<10; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	for i := 0; i < 1<<10; i++ {
+		m.Delete(strconv.Itoa(i))
+	}
+	assert.Equal(uint8(7), m.b)
+	assert.Equal(0, m.Count())
+}
+
+// 测试ShrinkToFit
+func TestShrinkToFit(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(1 << 10)
+	m.ShrinkToFit()
+	for i := 0; i < 1<<12; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	for i := 0; i < 1<<12; i += 2 {
+		m.Delete(strconv.Itoa(i))
+	}
+	m.ShrinkToFit()
+	assert.False(m.growing())
+	assert.Equal(uint8(9), m.b)
+	assert.Equal(1<<11, m.Count())
+	for i := 0; i < 1<<12; i++ {
+		val, ok := m.Get(strconv.Itoa(i))
+		if i%2 == 0 {
+			assert.False(ok, i)
+		} else {
+			assert.True(ok, i)
+			assert.Equal(i, val, i)
+		}
+	}
+	for i := 0; i < 1<<12; i++ {
+		m.Delete(strconv.Itoa(i))
+	}
+	m.ShrinkToFit()
+	assert.Equal(uint8(0), m.b)
+	assert.Equal(0, m.Count())
+}
+
+// 测试删除后移除空的溢出桶
+func TestUnlinkOverflow(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(1 << 10)
+	m.mapHash = collideHash{m.seed}
+	count := 32
+	for i := 0; i < count; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	assert.Equal(uint16(3), m.noverflow)
+	// 删除中间的溢出桶的全部元素
+	for i := 8; i < 16; i++ {
+		m.Delete(strconv.Itoa(i))
+	}
+	assert.Equal(uint16(2), m.noverflow)
+	for i := 0; i < count; i++ {
+		val, ok := m.Get(strconv.Itoa(i))
+		if i >= 8 && i < 16 {
+			assert.False(ok, i)
+		} else {
+			assert.True(ok, i)
+			assert.Equal(i, val, i)
+		}
+	}
+}
+
+// 哈希值固定，用于测试哈希值为0等情况
+type fixedHash struct {
+	seed maphash.Seed
+	hash uint64
+}
+
+func (hash fixedHash) Seed() maphash.Seed {
+	return hash.seed
+}
+
+func (hash fixedHash) Hash(key string) uint64 {
+	return hash.hash
+}
+
+// 测试tophash跳过状态值
+func TestCalTopHash(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(uint8(minTopHash), calTopHash(0))
+	assert.Equal(uint8(minTopHash+4), calTopHash(4<<56))
+	assert.Equal(uint8(minTopHash), calTopHash(minTopHash<<56))
+	assert.Equal(uint8(0xff), calTopHash(1<<64-1))
+}
+
+// 测试哈希值为0的key
+func TestZeroHash(t *testing.T) {
+	assert := assert.New(t)
+	for _, hash := range []uint64{0, 1 << 56, 1<<64 - 1} {
+		m := NewHMap(1 << 10)
+		m.mapHash = fixedHash{m.seed, hash}
+		for i := 0; i < 20; i++ {
+			m.Set(strconv.Itoa(i), i)
+		}
+		assert.Equal(20, m.Count())
+		for i := 0; i < 20; i++ {
+			val, ok := m.Get(strconv.Itoa(i))
+			assert.True(ok, i)
+			assert.Equal(i, val, i)
+		}
+	}
+}
+
+// 测试溢出桶链表中大量删除，之后的key仍能找到
+func TestDeleteChain(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(1 << 10)
+	m.mapHash = collideHash{m.seed}
+	count := 40
+	exists := make(map[int]bool)
+	for i := 0; i < count; i++ {
+		m.Set(strconv.Itoa(i), i)
+		exists[i] = true
+	}
+	// 每轮删除一部分再插入一部分
+	for round := 1; round < 8; round++ {
+		for i := 0; i < count; i++ {
+			if i%(round+1) == 0 {
+				m.Delete(strconv.Itoa(i))
+				delete(exists, i)
+			}
+		}
+		for i := 0; i < count; i++ {
+			val, ok := m.Get(strconv.Itoa(i))
+			assert.Equal(exists[i], ok, i)
+			if exists[i] {
+				assert.Equal(i, val, i)
+			}
+		}
+		for i := 0; i < count; i += round + 2 {
+			m.Set(strconv.Itoa(i), i)
+			exists[i] = true
+		}
+		assert.Equal(len(exists), m.Count())
+	}
+	// 全部删除后，正常桶第一个槽位为emptyRest
+	for i := 0; i < count; i++ {
+		m.Delete(strconv.Itoa(i))
+	}
+	bm := m.buckets[calbucket(1, m.b)]
+	assert.Equal(uint8(emptyRest), bm.tophash[0])
+	assert.Nil(bm.overflow)
+	assert.Equal(0, m.Count())
+}
+
+// 测试删除后emptyRest跨越溢出桶
+func TestEmptyRest(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(1 << 10)
+	m.mapHash = collideHash{m.seed}
+	for i := 0; i < 10; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	bm := m.buckets[calbucket(1, m.b)]
+	// 删除正常桶的后几个槽位，之后还有溢出桶，只能标记为emptyOne
+	m.Delete("6")
+	m.Delete("7")
+	assert.Equal(uint8(emptyOne), bm.tophash[6])
+	assert.Equal(uint8(emptyOne), bm.tophash[7])
+	// 删除溢出桶全部元素，向前标记为emptyRest
+	m.Delete("8")
+	m.Delete("9")
+	assert.Nil(bm.overflow)
+	assert.Equal(uint8(emptyRest), bm.tophash[6])
+	assert.Equal(uint8(emptyRest), bm.tophash[7])
+	for i := 0; i < 6; i++ {
+		val, ok := m.Get(strconv.Itoa(i))
+		assert.True(ok, i)
+		assert.Equal(i, val, i)
+	}
+}
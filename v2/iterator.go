@@ -0,0 +1,148 @@
+package v2
+
+import (
+	"math/rand"
+)
+
+// 迭代器不检查key所属的桶
+const noCheck = 1<<64 - 1
+
+// 迭代器，类似于golang中的hiter
+// 从随机的桶和桶内随机的位置开始遍历，每个元素只返回一次
+// 遍历中可以Set，Delete，新增的元素不保证能遍历到，删除的元素如果还未遍历到则不会返回
+// 如果开始遍历时正在缩容，会先一次性完成缩容
+type Iterator struct {
+	hm          *hmap
+	key         string
+	val         interface{}
+	buckets     []*bmap // 开始遍历时的正常桶
+	b           uint8   // 开始遍历时的b
+	startBucket uint64  // 开始的桶
+	offset      uint8   // 桶内开始的位置
+	wrapped     bool    // 是否已经从最后一个桶回到第一个桶
+	bucket      uint64  // 下一个要遍历的桶
+	bptr        *bmap   // 当前遍历的桶，正常桶或溢出桶
+	i           uint8   // 当前桶内已遍历的个数
+	checkBucket uint64  // 遍历旧桶时，只返回属于该新桶的元素
+	hashID      *hashID // 开始遍历时mapHash的标识，重新设置种子后旧桶中的哈希值不再可用
+}
+
+// 确定性模式下开始的位置由种子派生
+func (hm *hmap) Iterator() *Iterator {
+	if hm.Deterministic() {
+		return hm.iterator(hm.nextRand())
+	}
+	return hm.iterator(rand.Uint64())
+}
+
+// start的低b位为开始的桶，最高3位为桶内开始的位置
+func (hm *hmap) iterator(start uint64) *Iterator {
+	// 缩容时一个新桶对应两个旧桶，不能按新桶遍历旧桶
+	if hm.shrinking {
+		hm.finishGrow()
+	}
+	it := &Iterator{
+		hm:      hm,
+		buckets: hm.buckets,
+		b:       hm.b,
+		hashID:  hm.hashID,
+	}
+	if hm.buckets == nil {
+		return it
+	}
+	it.startBucket = calbucket(start, hm.b)
+	it.offset = uint8(start >> 61)
+	it.bucket = it.startBucket
+	return it
+}
+
+// 遍历所有元素，f返回false时停止
+func (hm *hmap) Range(f func(key string, val interface{}) bool) {
+	it := hm.Iterator()
+	for it.Next() {
+		if !f(it.Key(), it.Value()) {
+			return
+		}
+	}
+}
+
+// 移动到下一个元素，没有元素时返回false
+func (it *Iterator) Next() bool {
+	hm := it.hm
+	if it.buckets == nil {
+		return false
+	}
+	for {
+		if it.bptr == nil {
+			if it.bucket == it.startBucket && it.wrapped {
+				// 遍历结束
+				it.key = ""
+				it.val = nil
+				it.buckets = nil
+				return false
+			}
+			it.checkBucket = noCheck
+			if hm.growing() && !hm.shrinking && it.b == hm.b {
+				// 遍历开始时已在扩容中，且扩容还未结束
+				// 如果旧桶还未迁移，则遍历旧桶中属于当前新桶的元素
+				oldbm := hm.oldBuckets[it.bucket&hm.oldbucketmask()]
+				if !oldbm.evacuated() {
+					it.bptr = oldbm
+					it.checkBucket = it.bucket
+				} else {
+					it.bptr = it.buckets[it.bucket]
+				}
+			} else {
+				it.bptr = it.buckets[it.bucket]
+			}
+			it.bucket++
+			if it.bucket == uint64(len(it.buckets)) {
+				it.bucket = 0
+				it.wrapped = true
+			}
+			it.i = 0
+		}
+		for ; it.i < 8; it.i++ {
+			index := (it.i + it.offset) & 7
+			b := it.bptr
+			top := b.tophash[index]
+			if isEmpty(top) || top == evacuatedEmpty {
+				continue
+			}
+			hash := b.keyhash[index]
+			if it.checkBucket != noCheck && calbucket(hash, it.b) != it.checkBucket {
+				continue
+			}
+			key := b.keys[index]
+			if top != evacuatedX && top != evacuatedY {
+				it.key = key
+				it.val = b.vals[index]
+			} else {
+				// 元素已迁移，可能已被更新或删除，重新查找
+				if it.hashID != hm.hashID {
+					hash = hm.mapHash.Hash(key)
+				}
+				val, ok := hm.lookup(key, hash)
+				if !ok {
+					continue
+				}
+				it.key = key
+				it.val = val
+			}
+			it.i++
+			return true
+		}
+		it.bptr = it.bptr.overflow
+		it.i = 0
+	}
+}
+
+// 当前元素的key
+func (it *Iterator) Key() string {
+	return it.key
+}
+
+// 当前元素的val
+func (it *Iterator) Value() interface{} {
+	return it.val
+}
@@ -0,0 +1,145 @@
+package v2
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试遍历所有元素
+func TestRange1(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(0)
+	m.Range(func(key string, val interface{}) bool {
+		assert.Fail("empty map", key)
+		return true
+	})
+	count := 1 << 12
+	for i := 0; i < count; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	seen := make(map[string]int)
+	m.Range(func(key string, val interface{}) bool {
+		seen[key]++
+		assert.Equal(key, strconv.Itoa(val.(int)))
+		return true
+	})
+	assert.Equal(count, len(seen))
+	for k, n := range seen {
+		assert.Equal(1, n, k)
+	}
+}
+
+// 测试Range提前结束
+func TestRange2(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(100)
+	for i := 0; i < 100; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	n := 0
+	m.Range(func(key string, val interface{}) bool {
+		n++
+		return n < 10
+	})
+	assert.Equal(10, n)
+}
+
+// 测试随机的开始位置
+func TestIteratorRandom(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(100)
+	for i := 0; i < 100; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	first := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		it := m.Iterator()
+		assert.True(it.Next())
+		first[it.Key()] = true
+	}
+	assert.Greater(len(first), 1)
+}
+
+// 测试遍历中扩容，每个元素只返回一次
+func TestIteratorGrow(t *testing.T) {
+	assert := assert.New(t)
+	for _, cap := range []int{0, 1 << 4, 1 << 10} {
+		m := NewHMap(cap)
+		count := 1 << 10
+		for i := 0; i < count; i++ {
+			m.Set(strconv.Itoa(i), i)
+		}
+		seen := make(map[string]int)
+		added := count
+		it := m.Iterator()
+		for it.Next() {
+			seen[it.Key()]++
+			// 遍历中不断新增，触发多次扩容
+			for j := 0; j < 8; j++ {
+				m.Set(strconv.Itoa(added), added)
+				added++
+			}
+		}
+		for i := 0; i < count; i++ {
+			assert.Equal(1, seen[strconv.Itoa(i)], i)
+		}
+		for k, n := range seen {
+			assert.Equal(1, n, k)
+		}
+	}
+}
+
+// 测试扩容中开始遍历，遍历中更新
+func TestIteratorGrowing(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(1 << 10)
+	count := 0
+	for !m.growing() {
+		m.Set(strconv.Itoa(count), count)
+		count++
+	}
+	seen := make(map[string]int)
+	it := m.Iterator()
+	// 开始遍历后更新所有奇数，更新会迁移旧桶
+	for j := 1; j < count; j += 2 {
+		m.Set(strconv.Itoa(j), -j)
+	}
+	for it.Next() {
+		seen[it.Key()]++
+		i, _ := strconv.Atoi(it.Key())
+		if i%2 == 0 {
+			assert.Equal(i, it.Value(), i)
+		} else {
+			assert.Equal(-i, it.Value(), i)
+		}
+	}
+	assert.Equal(count, len(seen))
+	for k, n := range seen {
+		assert.Equal(1, n, k)
+	}
+}
+
+// 测试遍历中删除，未遍历到的元素不再返回
+func TestIteratorDelete(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(0)
+	count := 1 << 10
+	for i := 0; i < count; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	seen := make(map[string]bool)
+	it := m.Iterator()
+	for it.Next() {
+		assert.False(seen[it.Key()], it.Key())
+		seen[it.Key()] = true
+		for i := 0; i < count; i++ {
+			if !seen[strconv.Itoa(i)] {
+				m.Delete(strconv.Itoa(i))
+			}
+		}
+	}
+	assert.Equal(1, len(seen))
+	assert.Equal(1, m.Count())
+}
@@ -0,0 +1,256 @@
+package v2
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrLoaderPanic = errors.New("loading cache: loader panic")
+
+// 加载缺失的key
+type Loader interface {
+	Load(key string) (interface{}, error)
+}
+
+type LoaderFunc func(key string) (interface{}, error)
+
+func (f LoaderFunc) Load(key string) (interface{}, error) {
+	return f(key)
+}
+
+type LoadingOptions struct {
+	Loader       Loader        // 必须设置
+	RefreshAfter time.Duration // 加载后超过该时间为旧值，Get先返回旧值，同时在后台刷新，0表示不刷新
+	ExpireAfter  time.Duration // 加载后超过该时间不再返回，Get重新加载，0表示不过期
+	ErrorTTL     time.Duration // 加载失败的错误缓存的时间，期间Get直接返回该错误，0表示不缓存
+	Clock        Clock         // 默认使用系统时间
+	Cap          int           // map的预设容量
+}
+
+// 读穿透缓存，Get未命中时调用Loader加载
+// 同一个key同时只有一次加载，其他Get等待并共用加载的结果
+// 加载失败的错误可以缓存一段时间，旧值在后台刷新，刷新失败时继续使用旧值直到过期
+// 并发安全，所有状态由一把锁保护，加载时不持有锁
+type LoadingCache struct {
+	mu           sync.Mutex
+	hm           *hmap // val为*loadEntry
+	calls        *hmap // 正在进行的加载，val为*loadCall
+	loader       Loader
+	refreshAfter int64
+	expireAfter  int64
+	errorTTL     int64
+	clock        Clock
+	wg           sync.WaitGroup // 后台刷新
+	closed       bool           // Close之后不再在后台刷新
+}
+
+type loadEntry struct {
+	val        interface{}
+	err        error // 不为nil时为缓存的错误
+	loaded     int64 // 加载的时间，UnixNano
+	refreshing bool  // 后台正在刷新
+}
+
+type loadCall struct {
+	done    chan struct{}
+	val     interface{}
+	err     error
+	dups    int  // 等待结果的Get个数
+	dropped bool // 加载期间key被Set或Invalidate，结果不写入缓存
+}
+
+func NewLoadingCache(opts *LoadingOptions) *LoadingCache {
+	if opts == nil || opts.Loader == nil {
+		panic("loader is nil")
+	}
+	clock := opts.Clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+	c := &LoadingCache{
+		hm:           NewHMap(opts.Cap),
+		calls:        NewHMap(0),
+		loader:       opts.Loader,
+		refreshAfter: int64(opts.RefreshAfter),
+		expireAfter:  int64(opts.ExpireAfter),
+		errorTTL:     int64(opts.ErrorTTL),
+		clock:        clock,
+	}
+	return c
+}
+
+// 查找，未命中或已过期时加载，旧值先返回并在后台刷新
+func (c *LoadingCache) Get(key string) (interface{}, error) {
+	now := c.clock.Now().UnixNano()
+	c.mu.Lock()
+	if v, ok := c.hm.Get(key); ok {
+		e := v.(*loadEntry)
+		if e.err != nil {
+			if now-e.loaded < c.errorTTL {
+				c.mu.Unlock()
+				return nil, e.err
+			}
+		} else if !c.expired(e, now) {
+			if c.stale(e, now) && !e.refreshing {
+				c.startRefresh(key)
+			}
+			c.mu.Unlock()
+			return e.val, nil
+		}
+	}
+	if v, ok := c.calls.Get(key); ok {
+		call := v.(*loadCall)
+		call.dups++
+		c.mu.Unlock()
+		<-call.done
+		return call.val, call.err
+	}
+	call := &loadCall{done: make(chan struct{})}
+	c.calls.Set(key, call)
+	c.mu.Unlock()
+	c.load(key, call)
+	return call.val, call.err
+}
+
+// 查找，不加载也不刷新，返回未过期的值
+func (c *LoadingCache) GetIfPresent(key string) (interface{}, bool) {
+	now := c.clock.Now().UnixNano()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.hm.Get(key)
+	if !ok {
+		return nil, false
+	}
+	e := v.(*loadEntry)
+	if e.err != nil || c.expired(e, now) {
+		return nil, false
+	}
+	return e.val, true
+}
+
+// 直接写入，正在进行的加载结果不再写入缓存
+func (c *LoadingCache) Set(key string, val interface{}) {
+	now := c.clock.Now().UnixNano()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.drop(key)
+	c.hm.Set(key, &loadEntry{val: val, loaded: now})
+}
+
+// 删除key，包括缓存的错误，正在进行的加载结果不再写入缓存
+func (c *LoadingCache) Invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.drop(key)
+	c.hm.Delete(key)
+}
+
+// 在后台重新加载key，已经在加载时不重复加载
+func (c *LoadingCache) Refresh(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.startRefresh(key)
+}
+
+// 等待正在进行的后台刷新结束，之后旧值不再刷新，Get仍然可以同步加载
+func (c *LoadingCache) Close() {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	c.wg.Wait()
+}
+
+// 元素个数，包括缓存的错误和已过期但还未重新加载的元素
+func (c *LoadingCache) Count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hm.Count()
+}
+
+// 持有锁时调用，在后台加载key，已经在加载或者已经Close时不加载
+func (c *LoadingCache) startRefresh(key string) {
+	if c.closed {
+		return
+	}
+	if _, ok := c.calls.Get(key); ok {
+		return
+	}
+	if v, ok := c.hm.Get(key); ok {
+		v.(*loadEntry).refreshing = true
+	}
+	call := &loadCall{done: make(chan struct{})}
+	c.calls.Set(key, call)
+	c.wg.Add(1)
+	go c.refresh(key, call)
+}
+
+// 后台刷新，Loader panic时按ErrLoaderPanic处理，恢复panic，不影响进程
+func (c *LoadingCache) refresh(key string, call *loadCall) {
+	defer c.wg.Done()
+	defer func() {
+		recover()
+	}()
+	c.load(key, call)
+}
+
+// 调用Loader，结果写入缓存后唤醒等待的Get
+// Loader panic时等待的Get返回ErrLoaderPanic，panic继续向上传递，后台刷新时由refresh恢复
+func (c *LoadingCache) load(key string, call *loadCall) {
+	normal := false
+	defer func() {
+		if !normal {
+			call.err = ErrLoaderPanic
+			c.finish(key, call)
+		}
+	}()
+	call.val, call.err = c.loader.Load(key)
+	normal = true
+	c.finish(key, call)
+}
+
+func (c *LoadingCache) finish(key string, call *loadCall) {
+	now := c.clock.Now().UnixNano()
+	c.mu.Lock()
+	if !call.dropped {
+		c.calls.Delete(key)
+		c.store(key, call, now)
+	}
+	c.mu.Unlock()
+	close(call.done)
+}
+
+// 加载成功时写入新值，刷新失败时保留未过期的旧值，否则按ErrorTTL缓存错误
+func (c *LoadingCache) store(key string, call *loadCall, now int64) {
+	if call.err == nil {
+		c.hm.Set(key, &loadEntry{val: call.val, loaded: now})
+		return
+	}
+	if v, ok := c.hm.Get(key); ok {
+		e := v.(*loadEntry)
+		if e.err == nil && !c.expired(e, now) {
+			e.refreshing = false
+			return
+		}
+	}
+	if c.errorTTL > 0 && call.err != ErrLoaderPanic {
+		c.hm.Set(key, &loadEntry{err: call.err, loaded: now})
+		return
+	}
+	c.hm.Delete(key)
+}
+
+func (c *LoadingCache) drop(key string) {
+	if v, ok := c.calls.Get(key); ok {
+		v.(*loadCall).dropped = true
+		c.calls.Delete(key)
+	}
+}
+
+func (c *LoadingCache) stale(e *loadEntry, now int64) bool {
+	return c.refreshAfter > 0 && now-e.loaded >= c.refreshAfter
+}
+
+func (c *LoadingCache) expired(e *loadEntry, now int64) bool {
+	return c.expireAfter > 0 && now-e.loaded >= c.expireAfter
+}
@@ -0,0 +1,285 @@
+package v2
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoading1(t *testing.T) {
+	assert := assert.New(t)
+	var loads int32
+	c := NewLoadingCache(&LoadingOptions{Loader: LoaderFunc(func(key string) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		return "v" + key, nil
+	})})
+	for i := 0; i < 3; i++ {
+		val, err := c.Get("a")
+		assert.Nil(err)
+		assert.Equal("va", val)
+	}
+	assert.Equal(int32(1), loads)
+	_, ok := c.GetIfPresent("b")
+	assert.False(ok)
+
+	c.Set("b", "x")
+	val, err := c.Get("b")
+	assert.Nil(err)
+	assert.Equal("x", val)
+	assert.Equal(int32(1), loads)
+	assert.Equal(2, c.Count())
+
+	c.Invalidate("a")
+	val, _ = c.Get("a")
+	assert.Equal("va", val)
+	assert.Equal(int32(2), loads)
+}
+
+// 同一个key同时只加载一次
+func TestLoadingSingleflight(t *testing.T) {
+	assert := assert.New(t)
+	var loads int32
+	release := make(chan struct{})
+	c := NewLoadingCache(&LoadingOptions{Loader: LoaderFunc(func(key string) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return "v" + key, nil
+	})})
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := strconv.Itoa(i % 4)
+			val, err := c.Get(key)
+			assert.Nil(err)
+			assert.Equal("v"+key, val)
+		}(i)
+	}
+	for atomic.LoadInt32(&loads) < 4 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	assert.Equal(int32(4), loads)
+	assert.Equal(4, c.Count())
+}
+
+// 加载失败的错误缓存ErrorTTL
+func TestLoadingError(t *testing.T) {
+	assert := assert.New(t)
+	clock := newFakeClock()
+	errLoad := errors.New("load error")
+	var loads int32
+	fail := true
+	c := NewLoadingCache(&LoadingOptions{Clock: clock, ErrorTTL: time.Minute, Loader: LoaderFunc(func(key string) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		if fail {
+			return nil, errLoad
+		}
+		return 1, nil
+	})})
+	for i := 0; i < 3; i++ {
+		_, err := c.Get("a")
+		assert.Equal(errLoad, err)
+	}
+	assert.Equal(int32(1), loads)
+	_, ok := c.GetIfPresent("a")
+	assert.False(ok)
+
+	clock.Add(time.Minute)
+	fail = false
+	val, err := c.Get("a")
+	assert.Nil(err)
+	assert.Equal(1, val)
+	assert.Equal(int32(2), loads)
+
+	// 不缓存错误时每次都加载
+	c = NewLoadingCache(&LoadingOptions{Clock: clock, Loader: LoaderFunc(func(key string) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		return nil, errLoad
+	})})
+	for i := 0; i < 3; i++ {
+		_, err := c.Get("a")
+		assert.Equal(errLoad, err)
+	}
+	assert.Equal(int32(5), loads)
+	assert.Equal(0, c.Count())
+}
+
+// 等待所有正在进行的加载结束
+func waitLoads(c *LoadingCache) {
+	for {
+		c.mu.Lock()
+		n := c.calls.Count()
+		c.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// 旧值先返回，在后台刷新，刷新失败继续使用旧值，过期后同步加载
+func TestLoadingRefresh(t *testing.T) {
+	assert := assert.New(t)
+	clock := newFakeClock()
+	var version int32
+	var fail int32
+	c := NewLoadingCache(&LoadingOptions{
+		Clock:        clock,
+		RefreshAfter: time.Minute,
+		ExpireAfter:  10 * time.Minute,
+		Loader: LoaderFunc(func(key string) (interface{}, error) {
+			if atomic.LoadInt32(&fail) == 1 {
+				return nil, errors.New("refresh error")
+			}
+			return atomic.AddInt32(&version, 1), nil
+		}),
+	})
+	val, _ := c.Get("a")
+	assert.Equal(int32(1), val)
+
+	clock.Add(2 * time.Minute)
+	val, _ = c.Get("a")
+	assert.Equal(int32(1), val)
+	waitLoads(c)
+	val, _ = c.Get("a")
+	assert.Equal(int32(2), val)
+
+	// 刷新失败保留旧值
+	atomic.StoreInt32(&fail, 1)
+	clock.Add(2 * time.Minute)
+	val, err := c.Get("a")
+	assert.Nil(err)
+	assert.Equal(int32(2), val)
+	waitLoads(c)
+	val, err = c.Get("a")
+	assert.Nil(err)
+	assert.Equal(int32(2), val)
+	waitLoads(c)
+
+	// 过期后同步加载
+	atomic.StoreInt32(&fail, 0)
+	clock.Add(10 * time.Minute)
+	_, ok := c.GetIfPresent("a")
+	assert.False(ok)
+	val, _ = c.Get("a")
+	assert.Equal(int32(3), val)
+
+	c.Refresh("a")
+	waitLoads(c)
+	val, _ = c.GetIfPresent("a")
+	assert.Equal(int32(4), val)
+
+	// Close之后不再在后台刷新
+	c.Close()
+	clock.Add(2 * time.Minute)
+	val, _ = c.Get("a")
+	assert.Equal(int32(4), val)
+	c.Refresh("a")
+	c.mu.Lock()
+	assert.Equal(0, c.calls.Count())
+	c.mu.Unlock()
+}
+
+// 后台刷新时Loader panic，不影响进程，继续使用旧值
+func TestLoadingRefreshPanic(t *testing.T) {
+	assert := assert.New(t)
+	clock := newFakeClock()
+	var loads int32
+	c := NewLoadingCache(&LoadingOptions{
+		Clock:        clock,
+		RefreshAfter: time.Minute,
+		ExpireAfter:  10 * time.Minute,
+		Loader: LoaderFunc(func(key string) (interface{}, error) {
+			if atomic.AddInt32(&loads, 1) == 2 {
+				panic("boom")
+			}
+			return atomic.LoadInt32(&loads), nil
+		}),
+	})
+	val, _ := c.Get("a")
+	assert.Equal(int32(1), val)
+	clock.Add(2 * time.Minute)
+	val, err := c.Get("a")
+	assert.Nil(err)
+	assert.Equal(int32(1), val)
+	c.Close()
+	assert.Equal(int32(2), atomic.LoadInt32(&loads))
+	val, ok := c.GetIfPresent("a")
+	assert.True(ok)
+	assert.Equal(int32(1), val)
+
+	// 过期后同步加载
+	clock.Add(10 * time.Minute)
+	val, err = c.Get("a")
+	assert.Nil(err)
+	assert.Equal(int32(3), val)
+}
+
+// 加载期间Set或Invalidate，加载的结果不写入缓存
+func TestLoadingDrop(t *testing.T) {
+	assert := assert.New(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	c := NewLoadingCache(&LoadingOptions{Loader: LoaderFunc(func(key string) (interface{}, error) {
+		started <- struct{}{}
+		<-release
+		return "loaded", nil
+	})})
+	done := make(chan struct{})
+	go func() {
+		val, err := c.Get("a")
+		assert.Nil(err)
+		assert.Equal("loaded", val)
+		close(done)
+	}()
+	<-started
+	c.Set("a", "set")
+	close(release)
+	<-done
+	val, ok := c.GetIfPresent("a")
+	assert.True(ok)
+	assert.Equal("set", val)
+}
+
+// Loader panic时等待的Get返回ErrLoaderPanic
+func TestLoadingPanic(t *testing.T) {
+	assert := assert.New(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	c := NewLoadingCache(&LoadingOptions{ErrorTTL: time.Minute, Loader: LoaderFunc(func(key string) (interface{}, error) {
+		close(started)
+		<-release
+		panic("boom")
+	})})
+	done := make(chan error)
+	go func() {
+		defer func() {
+			recover()
+		}()
+		c.Get("a")
+	}()
+	<-started
+	go func() {
+		_, err := c.Get("a")
+		done <- err
+	}()
+	// 等待第二个Get进入等待
+	for dups := 0; dups == 0; {
+		time.Sleep(time.Millisecond)
+		c.mu.Lock()
+		v, _ := c.calls.Get("a")
+		dups = v.(*loadCall).dups
+		c.mu.Unlock()
+	}
+	close(release)
+	assert.Equal(ErrLoaderPanic, <-done)
+	assert.Equal(0, c.Count())
+}
@@ -0,0 +1,164 @@
+package v2
+
+// LRU缓存，hmap中的val就是链表节点，不需要额外的map
+// 链表头部为最近使用的元素，超过容量时淘汰尾部的元素
+// 不支持并发安全
+type LRUCache struct {
+	hm         *hmap
+	root       lruEntry // 哨兵节点，root.next为头部，root.prev为尾部
+	maxEntries int
+	onEvict    func(key string, val interface{})
+}
+
+type lruEntry struct {
+	key        string
+	val        interface{}
+	prev, next *lruEntry
+}
+
+// maxEntries为最大元素个数，onEvict在元素因超过容量被淘汰时调用，可以为nil
+func NewLRUCache(maxEntries int, onEvict func(key string, val interface{}), opts ...Option) *LRUCache {
+	if maxEntries <= 0 || maxEntries > 1<<30 {
+		panic("max entries error")
+	}
+	c := &LRUCache{
+		hm:         NewHMap(maxEntries, opts...),
+		maxEntries: maxEntries,
+		onEvict:    onEvict,
+	}
+	c.root.prev = &c.root
+	c.root.next = &c.root
+	return c
+}
+
+// 插入或更新，并移到头部，返回是否淘汰了元素
+func (c *LRUCache) Set(key string, val interface{}) bool {
+	hash := c.hm.mapHash.Hash(key)
+	if v, ok := c.hm.lookup(key, hash); ok {
+		e := v.(*lruEntry)
+		e.val = val
+		c.moveToFront(e)
+		return false
+	}
+	e := &lruEntry{key: key, val: val}
+	if c.hm.assign(key, e, hash) {
+		c.hm.count++
+		c.hm.checkFlood()
+	}
+	c.pushFront(e)
+	if c.hm.Count() > c.maxEntries {
+		c.evictOldest()
+		return true
+	}
+	return false
+}
+
+// 查找并移到头部
+func (c *LRUCache) Get(key string) (interface{}, bool) {
+	v, ok := c.hm.Get(key)
+	if !ok {
+		return nil, false
+	}
+	e := v.(*lruEntry)
+	c.moveToFront(e)
+	return e.val, true
+}
+
+// 查找，不改变顺序
+func (c *LRUCache) Peek(key string) (interface{}, bool) {
+	v, ok := c.hm.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return v.(*lruEntry).val, true
+}
+
+// 删除key，不调用onEvict，返回key是否存在
+func (c *LRUCache) Remove(key string) bool {
+	v, ok := c.hm.Get(key)
+	if !ok {
+		return false
+	}
+	c.unlink(v.(*lruEntry))
+	c.hm.Delete(key)
+	return true
+}
+
+// 最久未使用的元素
+func (c *LRUCache) Oldest() (string, interface{}, bool) {
+	if c.root.prev == &c.root {
+		return "", nil, false
+	}
+	e := c.root.prev
+	return e.key, e.val, true
+}
+
+func (c *LRUCache) Len() int {
+	return c.hm.Count()
+}
+
+func (c *LRUCache) Cap() int {
+	return c.maxEntries
+}
+
+// 修改容量，容量变小时淘汰多出的元素，返回淘汰的个数
+func (c *LRUCache) Resize(maxEntries int) int {
+	if maxEntries <= 0 || maxEntries > 1<<30 {
+		panic("max entries error")
+	}
+	c.maxEntries = maxEntries
+	evicted := 0
+	for c.hm.Count() > c.maxEntries {
+		c.evictOldest()
+		evicted++
+	}
+	return evicted
+}
+
+// 从最近使用到最久未使用遍历，不改变顺序，f中不能修改缓存
+func (c *LRUCache) Range(f func(key string, val interface{}) bool) {
+	for e := c.root.next; e != &c.root; e = e.next {
+		if !f(e.key, e.val) {
+			return
+		}
+	}
+}
+
+// 删除所有元素，不调用onEvict
+func (c *LRUCache) Purge() {
+	for c.root.next != &c.root {
+		e := c.root.next
+		c.unlink(e)
+		c.hm.Delete(e.key)
+	}
+}
+
+func (c *LRUCache) evictOldest() {
+	e := c.root.prev
+	c.unlink(e)
+	c.hm.Delete(e.key)
+	if c.onEvict != nil {
+		c.onEvict(e.key, e.val)
+	}
+}
+
+func (c *LRUCache) pushFront(e *lruEntry) {
+	e.prev = &c.root
+	e.next = c.root.next
+	c.root.next.prev = e
+	c.root.next = e
+}
+
+func (c *LRUCache) unlink(e *lruEntry) {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	e.prev, e.next = nil, nil
+}
+
+func (c *LRUCache) moveToFront(e *lruEntry) {
+	if c.root.next == e {
+		return
+	}
+	c.unlink(e)
+	c.pushFront(e)
+}
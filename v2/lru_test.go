@@ -0,0 +1,125 @@
+package v2
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRU1(t *testing.T) {
+	assert := assert.New(t)
+	var evicted []string
+	c := NewLRUCache(3, func(key string, val interface{}) {
+		evicted = append(evicted, key)
+	})
+	assert.False(c.Set("a", 1))
+	assert.False(c.Set("b", 2))
+	assert.False(c.Set("c", 3))
+	// a移到头部，淘汰b
+	val, ok := c.Get("a")
+	assert.True(ok)
+	assert.Equal(1, val)
+	assert.True(c.Set("d", 4))
+	assert.Equal([]string{"b"}, evicted)
+	assert.Equal([]string{"d", "a", "c"}, lruKeys(c))
+
+	// Peek不改变顺序
+	val, ok = c.Peek("c")
+	assert.True(ok)
+	assert.Equal(3, val)
+	key, val, ok := c.Oldest()
+	assert.True(ok)
+	assert.Equal("c", key)
+	assert.Equal(3, val)
+
+	// 更新移到头部
+	assert.False(c.Set("c", 30))
+	assert.Equal([]string{"c", "d", "a"}, lruKeys(c))
+	val, _ = c.Peek("c")
+	assert.Equal(30, val)
+
+	assert.True(c.Remove("d"))
+	assert.False(c.Remove("d"))
+	assert.Equal([]string{"c", "a"}, lruKeys(c))
+	assert.Equal(2, c.Len())
+	assert.Equal([]string{"b"}, evicted)
+	_, ok = c.Get("b")
+	assert.False(ok)
+}
+
+func TestLRUResize(t *testing.T) {
+	assert := assert.New(t)
+	var evicted []string
+	c := NewLRUCache(10, func(key string, val interface{}) {
+		evicted = append(evicted, key)
+	})
+	for i := 0; i < 10; i++ {
+		c.Set(strconv.Itoa(i), i)
+	}
+	assert.Equal(7, c.Resize(3))
+	assert.Equal(3, c.Cap())
+	assert.Equal([]string{"0", "1", "2", "3", "4", "5", "6"}, evicted)
+	assert.Equal([]string{"9", "8", "7"}, lruKeys(c))
+	assert.Equal(0, c.Resize(5))
+	c.Set("a", 1)
+	c.Set("b", 1)
+	assert.Equal(5, c.Len())
+	assert.Panics(func() { c.Resize(0) })
+
+	c.Purge()
+	assert.Equal(0, c.Len())
+	_, _, ok := c.Oldest()
+	assert.False(ok)
+	c.Set("x", 1)
+	assert.Equal([]string{"x"}, lruKeys(c))
+}
+
+// 测试大量随机操作后链表与map一致
+func TestLRUMany(t *testing.T) {
+	assert := assert.New(t)
+	c := NewLRUCache(100, nil, WithSeed(1))
+	for i := 0; i < 10000; i++ {
+		key := strconv.Itoa(i * 7919 % 300)
+		switch i % 4 {
+		case 0, 1:
+			c.Set(key, i)
+		case 2:
+			c.Get(key)
+		case 3:
+			c.Remove(key)
+		}
+		assert.LessOrEqual(c.Len(), 100)
+	}
+	keys := lruKeys(c)
+	assert.Len(keys, c.Len())
+	for _, key := range keys {
+		_, ok := c.Peek(key)
+		assert.True(ok)
+	}
+}
+
+func lruKeys(c *LRUCache) []string {
+	var keys []string
+	c.Range(func(key string, val interface{}) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+func BenchmarkLRU(b *testing.B) {
+	c := NewLRUCache(1<<12, nil)
+	keys := make([]string, 1<<13)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key := keys[i&(len(keys)-1)]
+		if _, ok := c.Get(key); !ok {
+			c.Set(key, i)
+		}
+	}
+}
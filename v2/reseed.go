@@ -0,0 +1,65 @@
+package v2
+
+import (
+	"hash/maphash"
+)
+
+// 重新设置种子的事件
+type ReseedEvent struct {
+	Chain   int    // 触发时链表中桶的个数
+	B       uint8  // 触发时的b
+	Count   int    // 元素个数
+	Reseeds uint64 // 包括本次在内，累计重新设置种子的次数
+}
+
+// 重新设置种子时调用f，f在Set中同步调用，不能修改map
+func WithReseedHook(f func(ReseedEvent)) Option {
+	return func(hm *hmap) {
+		hm.onReseed = f
+	}
+}
+
+// 重新设置种子的次数
+func (hm *hmap) Reseeds() uint64 {
+	return hm.reseeds
+}
+
+// 链表长度的阈值，随b缓慢增长
+// 哈希值均匀时，装载因子不超过6.5，最长的链表也只有两三个桶
+func floodThreshold(b uint8) int {
+	return 4 + int(b)/2
+}
+
+// 新增元素后链表过长，说明key可能是针对当前种子构造的冲突，换一个种子重建
+// 重建后元素个数翻倍之前不再触发，避免哈希函数本身有问题时反复重建
+// 哈希函数不使用种子时，换种子也是同样的冲突，不重建
+func (hm *hmap) checkFlood() {
+	if hm.chain <= floodThreshold(hm.b) || (hm.hashFunc == nil && hm.seedFunc == nil) || hm.unkeyed || hm.count < 2*hm.reseedCount {
+		return
+	}
+	hm.reseed(maphash.MakeSeed())
+}
+
+// 使用新的种子重建所有桶，b不变
+// 先完成正在进行的扩容，再按新的哈希函数一次性等量扩容
+// 旧桶中的槽位都标记为已迁移，遍历中的迭代器到新桶中重新查找
+func (hm *hmap) reseed(seed maphash.Seed) {
+	event := ReseedEvent{Chain: hm.chain, B: hm.b, Count: int(hm.count), Reseeds: hm.reseeds + 1}
+	hm.finishGrow()
+	hm.seed = seed
+	if hm.seedFunc != nil {
+		// 确定性模式下新的种子也由原来的种子派生
+		hm.setHash(hm.seedFunc(hm.nextRand()))
+	} else {
+		hm.setHash(hm.hashFunc(seed))
+	}
+	hm.startGrow(hm.b)
+	hm.rehash = true
+	hm.finishGrow()
+	hm.rehash = false
+	hm.reseeds = event.Reseeds
+	hm.reseedCount = hm.count
+	if hm.onReseed != nil {
+		hm.onReseed(event)
+	}
+}
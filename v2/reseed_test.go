@@ -0,0 +1,199 @@
+package v2
+
+import (
+	"hash/maphash"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 只有第一个种子会冲突，模拟攻击者针对当前种子构造的key
+func TestReseed(t *testing.T) {
+	assert := assert.New(t)
+	calls := 0
+	f := func(seed maphash.Seed) Hash {
+		calls++
+		if calls == 1 {
+			return collideHash{seed}
+		}
+		return newMapHash(seed)
+	}
+	var events []ReseedEvent
+	m := NewHMap(0, WithHash(f), WithReseedHook(func(e ReseedEvent) {
+		events = append(events, e)
+	}))
+	seed := m.seed
+	count := 1 << 12
+	for i := 0; i < count; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	assert.Len(events, 1)
+	assert.Equal(uint64(1), m.Reseeds())
+	assert.Equal(ReseedEvent{Chain: floodThreshold(3) + 1, B: 3, Count: 41, Reseeds: 1}, events[0])
+	assert.NotEqual(seed, m.seed)
+	assert.Equal(m.seed, m.mapHash.Seed())
+	assert.Equal(count, m.Count())
+	for i := 0; i < count; i++ {
+		val, ok := m.Get(strconv.Itoa(i))
+		assert.True(ok, i)
+		assert.Equal(i, val)
+	}
+	assert.LessOrEqual(maxChain(m), floodThreshold(m.b))
+}
+
+// 所有key的哈希值都相同，但随种子变化，重新设置种子也不能解决冲突
+type seedCollideHash struct {
+	seed maphash.Seed
+}
+
+func (hash seedCollideHash) Seed() maphash.Seed {
+	return hash.seed
+}
+
+func (hash seedCollideHash) Hash(key string) uint64 {
+	return maphash.String(hash.seed, "")
+}
+
+// 哈希函数本身总是冲突时，重建次数随元素个数对数增长
+func TestReseedCollide(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(0, WithHash(func(seed maphash.Seed) Hash { return seedCollideHash{seed} }))
+	count := 1 << 10
+	for i := 0; i < count; i++ {
+		m.SetBytes([]byte(strconv.Itoa(i)), i)
+	}
+	assert.Greater(m.Reseeds(), uint64(0))
+	assert.Less(m.Reseeds(), uint64(10))
+	assert.Equal(count, m.Count())
+	for i := 0; i < count; i++ {
+		val, ok := m.Get(strconv.Itoa(i))
+		assert.True(ok, i)
+		assert.Equal(i, val)
+	}
+}
+
+// 测试正常的哈希函数不会触发，直接设置的mapHash不会被替换
+func TestReseedNone(t *testing.T) {
+	assert := assert.New(t)
+	for _, name := range HashNames() {
+		m := NewHMap(0, WithHashName(name))
+		for i := 0; i < 1<<16; i++ {
+			m.Set(strconv.Itoa(i), i)
+		}
+		assert.Equal(uint64(0), m.Reseeds(), name)
+	}
+
+	m := NewHMap(0)
+	m.mapHash = collideHash{m.seed}
+	m.hashFunc = nil
+	for i := 0; i < 100; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	assert.Equal(uint64(0), m.Reseeds())
+	assert.Equal(collideHash{m.seed}, m.mapHash)
+}
+
+// 不使用种子的哈希函数，链表过长也不重新设置种子
+func TestReseedUnkeyed(t *testing.T) {
+	assert := assert.New(t)
+	for _, name := range HashNames() {
+		m := NewHMap(0, WithHashName(name))
+		assert.Equal(name == "fnv1a", m.unkeyed, name)
+		assert.Equal(m.unkeyed, NewHMap(0, WithHashOf(m)).unkeyed, name)
+	}
+	assert.False(NewHMap(0).unkeyed)
+	assert.False(NewHMap(0, WithSeed(1)).unkeyed)
+	assert.True(NewHMap(0, WithSeedHash(1, func(seed uint64) Hash { return NewFNV1a() })).unkeyed)
+
+	m := NewHMap(0, WithHash(func(seed maphash.Seed) Hash { return collideHash{seed} }))
+	assert.True(m.unkeyed)
+	count := 1 << 10
+	for i := 0; i < count; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	assert.Equal(uint64(0), m.Reseeds())
+	assert.Equal(count, m.Count())
+}
+
+// 测试遍历中重新设置种子，每个元素只返回一次，不返回已删除的元素，返回更新后的值
+func TestReseedIterator(t *testing.T) {
+	assert := assert.New(t)
+	for _, growing := range []bool{false, true} {
+		m := NewHMap(0)
+		count := 100
+		for i := 0; i < count; i++ {
+			m.Set(strconv.Itoa(i), i)
+		}
+		if growing {
+			m.startGrow(m.b + 1)
+		}
+		it := m.Iterator()
+		seen := make(map[string]int)
+		for i := 0; it.Next(); i++ {
+			seen[it.Key()]++
+			key, _ := strconv.Atoi(it.Key())
+			if i > 10 {
+				assert.NotEqual(0, key%3, key)
+				assert.Equal(key%3 == 1, it.Value() == -key, key)
+			}
+			if i == 10 {
+				m.reseed(maphash.MakeSeed())
+				assert.False(m.growing())
+				for j := 0; j < count; j++ {
+					switch j % 3 {
+					case 0:
+						m.Delete(strconv.Itoa(j))
+					case 1:
+						m.Set(strconv.Itoa(j), -j)
+					}
+				}
+			}
+		}
+		for key, n := range seen {
+			assert.Equal(1, n, key)
+		}
+		for i := 0; i < count; i++ {
+			_, ok := seen[strconv.Itoa(i)]
+			// 重新设置种子前已经返回的元素，可能已被删除
+			if i%3 != 0 {
+				assert.True(ok, i)
+			}
+		}
+		assert.LessOrEqual(len(seen), count*2/3+11)
+		assert.Equal(count*2/3, m.Count())
+	}
+}
+
+// 重新设置种子不会清空HashMismatches
+func TestReseedKeepState(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(0)
+	m2 := NewHMap(0)
+	m.Set("a", 1)
+	m.GetHashed("a", m2.HashKey("a"))
+	assert.Equal(uint64(1), m.HashMismatches())
+	codec := stringCodec{}
+	m.SetCodec(codec)
+	m.reseed(maphash.MakeSeed())
+	assert.Equal(uint64(1), m.HashMismatches())
+	assert.Equal(codec, m.codec)
+	val, ok := m.Get("a")
+	assert.True(ok)
+	assert.Equal(1, val)
+}
+
+// 所有正常桶中最长链表的长度
+func maxChain(m *hmap) int {
+	longest := 0
+	for _, bm := range m.buckets {
+		n := 0
+		for b := bm; b != nil; b = b.overflow {
+			n++
+		}
+		if n > longest {
+			longest = n
+		}
+	}
+	return longest
+}
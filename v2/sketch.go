@@ -0,0 +1,94 @@
+package v2
+
+import (
+	"math/bits"
+)
+
+// count-min sketch，估计key最近的访问频率
+// 4行4bit的计数器，每个uint64放16个，计数最大15
+// 增加的次数达到10倍宽度时所有计数减半，使旧的访问逐渐失效
+const (
+	sketchDepth = 4
+	sketchMax   = 15
+)
+
+type cmSketch struct {
+	table     []uint64
+	width     uint64 // 每行的计数器个数，2的幂
+	additions int
+	sample    int // additions达到sample时减半
+}
+
+func newCMSketch(n int) *cmSketch {
+	width := uint64(16)
+	if n > 16 {
+		width = 1 << bits.Len(uint(n-1))
+	}
+	s := &cmSketch{
+		table:  make([]uint64, width*sketchDepth/16),
+		width:  width,
+		sample: 10 * int(width),
+	}
+	return s
+}
+
+// 第i行计数器的下标，用哈希值的高低32位组合出4个不同的下标
+func (s *cmSketch) index(hash uint64, i int) uint64 {
+	h1 := hash & 0xffffffff
+	h2 := hash>>32 | 1
+	return uint64(i)*s.width + (h1+uint64(i)*h2)&(s.width-1)
+}
+
+func (s *cmSketch) counter(j uint64) uint64 {
+	return s.table[j/16] >> (j % 16 * 4) & 0xf
+}
+
+// 4行中最小的计数
+func (s *cmSketch) estimate(hash uint64) int {
+	min := uint64(sketchMax)
+	for i := 0; i < sketchDepth; i++ {
+		if c := s.counter(s.index(hash, i)); c < min {
+			min = c
+		}
+	}
+	return int(min)
+}
+
+// 4行中最小的计数加1，已经最大时不变
+func (s *cmSketch) increment(hash uint64) {
+	var idx [sketchDepth]uint64
+	min := uint64(sketchMax)
+	for i := range idx {
+		idx[i] = s.index(hash, i)
+		if c := s.counter(idx[i]); c < min {
+			min = c
+		}
+	}
+	if min == sketchMax {
+		return
+	}
+	for _, j := range idx {
+		if s.counter(j) == min {
+			s.table[j/16] += 1 << (j % 16 * 4)
+		}
+	}
+	s.additions++
+	if s.additions >= s.sample {
+		s.age()
+	}
+}
+
+// 所有计数减半
+func (s *cmSketch) age() {
+	for i := range s.table {
+		s.table[i] = s.table[i] >> 1 & 0x7777777777777777
+	}
+	s.additions /= 2
+}
+
+func (s *cmSketch) clear() {
+	for i := range s.table {
+		s.table[i] = 0
+	}
+	s.additions = 0
+}
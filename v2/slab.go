@@ -0,0 +1,363 @@
+package v2
+
+import (
+	"encoding/binary"
+	"hash/maphash"
+	"math/bits"
+)
+
+// SlabMap的key和val保存在大块的[]byte中，桶中只保存位置，桶和slab都不包含指针
+// 元素再多，GC也只需要扫描slab切片本身
+const (
+	slabSize        = 1 << 20 // 每个slab的大小，更大的元素单独分配
+	slabEntryHeader = 8       // keyLen[4] valLen[4]
+	slabMinClass    = 4       // 最小的分配单位为16字节
+	slabCompactMin  = slabSize
+)
+
+// 桶的结构与bmap相同，key，val换成了在slab中的位置
+type sbucket struct {
+	tophash  [8]uint8
+	keyhash  [8]uint64
+	locs     [8]uint64 // slab下标<<32 | slab内的偏移
+	overflow uint32    // 溢出桶在buckets中的下标，0表示没有
+}
+
+type SlabMap struct {
+	count     uint
+	b         uint8
+	buckets   []sbucket // 前2^b个为正常桶，之后为溢出桶
+	noverflow uint      // 溢出桶个数
+	cap       uint
+	mapHash   Hash
+	seed      maphash.Seed
+	arena     slabArena
+}
+
+// slab的使用情况
+type SlabStats struct {
+	Slabs     int    // slab个数
+	SlabBytes uint64 // 所有slab的大小
+	LiveBytes uint64 // 有效元素占用的大小
+	FreeBytes uint64 // 删除后等待复用的大小
+}
+
+func NewSlabMap(cap int) *SlabMap {
+	if cap < 0 || cap > 1<<30 {
+		panic("cap error")
+	}
+	seed := maphash.MakeSeed()
+	sm := &SlabMap{
+		cap:     uint(cap),
+		seed:    seed,
+		mapHash: newMapHash(seed),
+	}
+	sm.b = capb(sm.cap)
+	sm.buckets = make([]sbucket, 1<<sm.b)
+	return sm
+}
+
+func (sm *SlabMap) Set(key string, val []byte) {
+	hash := sm.mapHash.Hash(key)
+	if bi, i, ok := sm.find(key, hash); ok {
+		b := &sm.buckets[bi]
+		b.locs[i] = sm.arena.replace(b.locs[i], key, val)
+		sm.maybeCompact()
+		return
+	}
+	if sm.overLoadFactor(sm.count+1) || sm.tooManyOverflow() {
+		sm.grow()
+	}
+	sm.insert(hash, sm.arena.alloc(key, val))
+	sm.count++
+}
+
+// 返回val的副本
+func (sm *SlabMap) Get(key string) ([]byte, bool) {
+	bi, i, ok := sm.find(key, sm.mapHash.Hash(key))
+	if !ok {
+		return nil, false
+	}
+	_, val := sm.arena.entry(sm.buckets[bi].locs[i])
+	return append([]byte{}, val...), true
+}
+
+func (sm *SlabMap) Delete(key string) {
+	hash := sm.mapHash.Hash(key)
+	bi, i, ok := sm.find(key, hash)
+	if !ok {
+		return
+	}
+	b := &sm.buckets[bi]
+	sm.arena.release(b.locs[i])
+	b.tophash[i] = emptyOne
+	b.keyhash[i] = 0
+	b.locs[i] = 0
+	sm.count--
+	sm.markEmptyRest(calbucket(hash, sm.b))
+	sm.maybeCompact()
+}
+
+func (sm *SlabMap) Count() int {
+	return int(sm.count)
+}
+
+// 按桶的顺序遍历，val引用slab，只在f中有效
+func (sm *SlabMap) Range(f func(key string, val []byte) bool) {
+	for bi := range sm.buckets {
+		b := &sm.buckets[bi]
+		for i := 0; i < 8; i++ {
+			if isEmpty(b.tophash[i]) {
+				continue
+			}
+			key, val := sm.arena.entry(b.locs[i])
+			if !f(string(key), val) {
+				return
+			}
+		}
+	}
+}
+
+func (sm *SlabMap) Stats() SlabStats {
+	a := &sm.arena
+	var size uint64
+	for _, s := range a.slabs {
+		size += uint64(len(s))
+	}
+	return SlabStats{Slabs: len(a.slabs), SlabBytes: size, LiveBytes: a.live, FreeBytes: a.free}
+}
+
+// 将所有元素复制到新的slab中，释放旧的slab
+func (sm *SlabMap) Compact() {
+	var arena slabArena
+	for bi := range sm.buckets {
+		b := &sm.buckets[bi]
+		for i := 0; i < 8; i++ {
+			if isEmpty(b.tophash[i]) {
+				continue
+			}
+			key, val := sm.arena.entry(b.locs[i])
+			b.locs[i] = arena.allocBytes(key, val)
+		}
+	}
+	sm.arena = arena
+}
+
+// 等待复用的空间超过一半时整理
+func (sm *SlabMap) maybeCompact() {
+	if sm.arena.free >= slabCompactMin && sm.arena.free > sm.arena.live {
+		sm.Compact()
+	}
+}
+
+// 查找key所在的桶下标和槽位
+// 遇到emptyRest说明之后都为空，提前结束
+func (sm *SlabMap) find(key string, hash uint64) (uint32, int, bool) {
+	tophash := calTopHash(hash)
+	for bi := uint32(calbucket(hash, sm.b)); ; {
+		b := &sm.buckets[bi]
+		for i := 0; i < 8; i++ {
+			if b.tophash[i] != tophash {
+				if b.tophash[i] == emptyRest {
+					return 0, 0, false
+				}
+				continue
+			}
+			if b.keyhash[i] == hash {
+				if k, _ := sm.arena.entry(b.locs[i]); string(k) == key {
+					return bi, i, true
+				}
+			}
+		}
+		if b.overflow == 0 {
+			return 0, 0, false
+		}
+		bi = b.overflow
+	}
+}
+
+// 插入到正常桶或其溢出桶的空闲处，都满了就追加一个溢出桶
+func (sm *SlabMap) insert(hash uint64, loc uint64) {
+	bi := uint32(calbucket(hash, sm.b))
+	for {
+		b := &sm.buckets[bi]
+		for i := 0; i < 8; i++ {
+			if isEmpty(b.tophash[i]) {
+				b.tophash[i] = calTopHash(hash)
+				b.keyhash[i] = hash
+				b.locs[i] = loc
+				return
+			}
+		}
+		if b.overflow == 0 {
+			sm.buckets = append(sm.buckets, sbucket{})
+			sm.noverflow++
+			next := uint32(len(sm.buckets) - 1)
+			sm.buckets[bi].overflow = next
+			bi = next
+			continue
+		}
+		bi = b.overflow
+	}
+}
+
+// 从链表末尾向前，将连续的emptyOne改为emptyRest
+func (sm *SlabMap) markEmptyRest(bucketIndex uint64) {
+	var chain []uint32
+	for bi := uint32(bucketIndex); ; bi = sm.buckets[bi].overflow {
+		chain = append(chain, bi)
+		if sm.buckets[bi].overflow == 0 {
+			break
+		}
+	}
+	for c := len(chain) - 1; c >= 0; c-- {
+		b := &sm.buckets[chain[c]]
+		for i := 7; i >= 0; i-- {
+			if b.tophash[i] == emptyRest {
+				continue
+			}
+			if b.tophash[i] != emptyOne {
+				return
+			}
+			b.tophash[i] = emptyRest
+		}
+	}
+}
+
+// 装载因子超过6.5时容量翻倍，溢出桶太多时等量重建，一次性完成
+// 元素留在slab中，只重新分配桶
+func (sm *SlabMap) grow() {
+	B := sm.b
+	if sm.overLoadFactor(sm.count + 1) {
+		B++
+	}
+	old := sm.buckets
+	sm.b = B
+	sm.buckets = make([]sbucket, 1<<B)
+	sm.noverflow = 0
+	for bi := range old {
+		b := &old[bi]
+		for i := 0; i < 8; i++ {
+			if !isEmpty(b.tophash[i]) {
+				sm.insert(b.keyhash[i], b.locs[i])
+			}
+		}
+	}
+}
+
+// 溢出桶比正常桶多，且一半以上的槽位为空，说明删除留下了太多空的溢出桶
+func (sm *SlabMap) tooManyOverflow() bool {
+	return sm.noverflow >= 1<<sm.b && sm.count*2 < uint(len(sm.buckets))*8
+}
+
+func (sm *SlabMap) overLoadFactor(count uint) bool {
+	return overLoadFactor(count, 1<<sm.b)
+}
+
+// 按2的幂大小分级分配，删除后按级别放入空闲链表复用
+type slabArena struct {
+	slabs [][]byte
+	cur   int        // 当前分配的slab下标
+	used  int        // 当前slab已分配的长度
+	lists [][]uint64 // 每个级别的空闲位置
+	live  uint64
+	free  uint64
+}
+
+// 元素大小对应的级别
+func slabClass(size int) uint8 {
+	if size <= 1<<slabMinClass {
+		return slabMinClass
+	}
+	return uint8(bits.Len(uint(size - 1)))
+}
+
+func (a *slabArena) alloc(key string, val []byte) uint64 {
+	loc := a.reserve(slabEntryHeader + len(key) + len(val))
+	a.write(loc, key, val)
+	return loc
+}
+
+func (a *slabArena) allocBytes(key []byte, val []byte) uint64 {
+	loc := a.reserve(slabEntryHeader + len(key) + len(val))
+	a.write(loc, string(key), val)
+	return loc
+}
+
+// 大小在同一级别时原地更新，否则重新分配
+func (a *slabArena) replace(loc uint64, key string, val []byte) uint64 {
+	old := a.span(loc)
+	size := slabEntryHeader + len(key) + len(val)
+	if slabClass(size) == slabClass(len(old)) {
+		a.live += uint64(size) - uint64(len(old))
+		a.write(loc, key, val)
+		return loc
+	}
+	a.release(loc)
+	return a.alloc(key, val)
+}
+
+// 分配size大小的空间，优先复用同级别的空闲位置
+// 超过slabSize的元素单独使用一个slab
+func (a *slabArena) reserve(size int) uint64 {
+	class := slabClass(size)
+	a.live += uint64(size)
+	if int(class) < len(a.lists) {
+		if list := a.lists[class]; len(list) > 0 {
+			loc := list[len(list)-1]
+			a.lists[class] = list[:len(list)-1]
+			a.free -= 1 << class
+			return loc
+		}
+	}
+	n := 1 << class
+	if n > slabSize {
+		a.slabs = append(a.slabs, make([]byte, n))
+		return uint64(len(a.slabs)-1) << 32
+	}
+	if len(a.slabs) == 0 || a.used+n > slabSize {
+		a.slabs = append(a.slabs, make([]byte, slabSize))
+		a.cur = len(a.slabs) - 1
+		a.used = 0
+	}
+	loc := uint64(a.cur)<<32 | uint64(a.used)
+	a.used += n
+	return loc
+}
+
+func (a *slabArena) write(loc uint64, key string, val []byte) {
+	s := a.slabs[loc>>32][uint32(loc):]
+	binary.LittleEndian.PutUint32(s, uint32(len(key)))
+	binary.LittleEndian.PutUint32(s[4:], uint32(len(val)))
+	copy(s[slabEntryHeader:], key)
+	copy(s[slabEntryHeader+len(key):], val)
+}
+
+// 释放loc处的元素，放入空闲链表
+func (a *slabArena) release(loc uint64) {
+	size := len(a.span(loc))
+	class := slabClass(size)
+	for int(class) >= len(a.lists) {
+		a.lists = append(a.lists, nil)
+	}
+	a.lists[class] = append(a.lists[class], loc)
+	a.live -= uint64(size)
+	a.free += 1 << class
+}
+
+// loc处元素的key和val
+func (a *slabArena) entry(loc uint64) ([]byte, []byte) {
+	s := a.slabs[loc>>32][uint32(loc):]
+	keyLen := binary.LittleEndian.Uint32(s)
+	valLen := binary.LittleEndian.Uint32(s[4:])
+	key := s[slabEntryHeader : slabEntryHeader+keyLen]
+	return key, s[slabEntryHeader+keyLen : slabEntryHeader+keyLen+valLen : slabEntryHeader+keyLen+valLen]
+}
+
+// loc处整个元素占用的字节，包括header
+func (a *slabArena) span(loc uint64) []byte {
+	s := a.slabs[loc>>32][uint32(loc):]
+	keyLen := binary.LittleEndian.Uint32(s)
+	valLen := binary.LittleEndian.Uint32(s[4:])
+	return s[:slabEntryHeader+int(keyLen)+int(valLen)]
+}
@@ -0,0 +1,211 @@
+package v2
+
+import (
+	"bytes"
+	"reflect"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlab1(t *testing.T) {
+	assert := assert.New(t)
+	m := NewSlabMap(0)
+	count := 1 << 14
+	for i := 0; i < count; i++ {
+		m.Set(strconv.Itoa(i), []byte(strconv.Itoa(i*i)))
+	}
+	assert.Equal(count, m.Count())
+	for i := 0; i < count; i++ {
+		val, ok := m.Get(strconv.Itoa(i))
+		assert.True(ok, i)
+		assert.Equal(strconv.Itoa(i*i), string(val))
+	}
+	// 更新为同级别和不同级别的大小
+	m.Set("1", []byte("a"))
+	m.Set("2", bytes.Repeat([]byte("b"), 100))
+	val, _ := m.Get("1")
+	assert.Equal("a", string(val))
+	val, _ = m.Get("2")
+	assert.Equal(bytes.Repeat([]byte("b"), 100), val)
+	assert.Equal(count, m.Count())
+
+	for i := 0; i < count; i += 2 {
+		m.Delete(strconv.Itoa(i))
+	}
+	m.Delete("x")
+	assert.Equal(count/2, m.Count())
+	n := 0
+	m.Range(func(key string, val []byte) bool {
+		i, _ := strconv.Atoi(key)
+		assert.Equal(1, i%2)
+		n++
+		return true
+	})
+	assert.Equal(count/2, n)
+
+	// Get返回副本
+	val, _ = m.Get("3")
+	val[0] = 'x'
+	val, _ = m.Get("3")
+	assert.Equal("9", string(val))
+}
+
+// 测试桶和slab不包含指针
+func TestSlabNoPointers(t *testing.T) {
+	assert := assert.New(t)
+	assert.False(hasPointers(reflect.TypeOf(sbucket{})))
+	assert.False(hasPointers(reflect.TypeOf([]sbucket{}).Elem()))
+	assert.False(hasPointers(reflect.TypeOf([]byte{}).Elem()))
+	assert.True(hasPointers(reflect.TypeOf(bmap{})))
+}
+
+func hasPointers(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.String, reflect.Slice, reflect.Map, reflect.Interface,
+		reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return true
+	case reflect.Array:
+		return t.Len() > 0 && hasPointers(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if hasPointers(t.Field(i).Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 测试删除后复用空间
+func TestSlabReuse(t *testing.T) {
+	assert := assert.New(t)
+	m := NewSlabMap(0)
+	val := make([]byte, 100)
+	for i := 0; i < 1<<14; i++ {
+		m.Set(strconv.Itoa(i), val)
+	}
+	stats := m.Stats()
+	for round := 0; round < 10; round++ {
+		for i := 0; i < 1<<14; i++ {
+			m.Delete(strconv.Itoa(i))
+			m.Set(strconv.Itoa(i+1<<20), val)
+			m.Delete(strconv.Itoa(i + 1<<20))
+			m.Set(strconv.Itoa(i), val)
+		}
+	}
+	assert.Equal(stats, m.Stats())
+}
+
+// 测试空闲空间过多时整理
+func TestSlabCompact(t *testing.T) {
+	assert := assert.New(t)
+	m := NewSlabMap(0)
+	val := make([]byte, 200)
+	count := 1 << 15
+	for i := 0; i < count; i++ {
+		m.Set(strconv.Itoa(i), val)
+	}
+	before := m.Stats()
+	assert.Greater(before.Slabs, 4)
+	for i := 0; i < count; i++ {
+		if i%8 != 0 {
+			m.Delete(strconv.Itoa(i))
+		}
+	}
+	after := m.Stats()
+	assert.Less(after.Slabs, before.Slabs/2)
+	assert.LessOrEqual(after.FreeBytes, after.LiveBytes+slabCompactMin)
+	for i := 0; i < count; i += 8 {
+		v, ok := m.Get(strconv.Itoa(i))
+		assert.True(ok)
+		assert.Equal(val, v)
+	}
+
+	m.Compact()
+	stats := m.Stats()
+	assert.Equal(uint64(0), stats.FreeBytes)
+	assert.Equal(after.LiveBytes, stats.LiveBytes)
+	assert.Equal(count/8, m.Count())
+}
+
+// 测试大于slabSize的元素
+func TestSlabLarge(t *testing.T) {
+	assert := assert.New(t)
+	m := NewSlabMap(0)
+	big := bytes.Repeat([]byte("x"), slabSize+1)
+	m.Set("a", []byte("1"))
+	m.Set("big", big)
+	m.Set("b", []byte("2"))
+	val, _ := m.Get("big")
+	assert.Equal(big, val)
+	val, _ = m.Get("b")
+	assert.Equal("2", string(val))
+	m.Delete("big")
+	assert.Equal(2, m.Count())
+	val, _ = m.Get("a")
+	assert.Equal("1", string(val))
+}
+
+// 测试删除留下的溢出桶在重建后回收
+func TestSlabOverflow(t *testing.T) {
+	assert := assert.New(t)
+	m := NewSlabMap(64)
+	assert.Equal(uint8(3), m.b)
+	// 依次在不同的桶中插入再删除，每次留下4个空的溢出桶
+	// 第二次插入时溢出桶达到8个，重建后只剩第二次插入使用的溢出桶
+	for j := uint64(0); j < 2; j++ {
+		m.mapHash = fixedHash{seed: m.seed, hash: j}
+		for i := 0; i < 40; i++ {
+			m.Set(strconv.Itoa(i), []byte{byte(i)})
+		}
+		for i := 0; i < 40; i++ {
+			val, ok := m.Get(strconv.Itoa(i))
+			assert.True(ok)
+			assert.Equal([]byte{byte(i)}, val)
+		}
+		for i := 0; i < 40; i++ {
+			m.Delete(strconv.Itoa(i))
+		}
+	}
+	assert.Equal(8+4, len(m.buckets))
+	assert.Equal(uint(4), m.noverflow)
+	assert.Equal(uint8(3), m.b)
+	m.Set("x", nil)
+	_, ok := m.Get("x")
+	assert.True(ok)
+}
+
+// 比较hmap和SlabMap在大量元素时GC标记的耗时
+func BenchmarkSlabGC(b *testing.B) {
+	const count = 1 << 20
+	val := make([]byte, 16)
+	for _, name := range []string{"hmap", "slab"} {
+		b.Run(name, func(b *testing.B) {
+			var keep interface{}
+			if name == "hmap" {
+				m := NewHMap(count)
+				for i := 0; i < count; i++ {
+					m.Set(strconv.Itoa(i), val)
+				}
+				keep = m
+			} else {
+				m := NewSlabMap(count)
+				for i := 0; i < count; i++ {
+					m.Set(strconv.Itoa(i), val)
+				}
+				keep = m
+			}
+			b.ResetTimer()
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+			}
+			b.ReportMetric(float64(time.Since(start).Microseconds())/float64(b.N), "us/gc")
+			runtime.KeepAlive(keep)
+		})
+	}
+}
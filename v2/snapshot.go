@@ -0,0 +1,257 @@
+package v2
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// 快照格式，整数均为小端序
+//
+//	header: magic[4] version[2] b[1] count[8]
+//	entry:  keyLen[uvarint] key valLen[uvarint] val，共count个
+//	footer: crc32[4]，header和所有entry的CRC32(IEEE)
+const (
+	snapshotMagic   = "HMAP"
+	snapshotVersion = 1
+	snapshotHeader  = 4 + 2 + 1 + 8
+	maxSnapshotLen  = 1 << 31 // key或val的最大长度
+	maxSnapshotPre  = 1 << 16 // 按count预先分配的最大容量，更多的元素边读边扩容
+)
+
+var (
+	ErrSnapshotMagic    = errors.New("hmap snapshot: invalid magic")
+	ErrSnapshotVersion  = errors.New("hmap snapshot: unsupported version")
+	ErrSnapshotTruncate = errors.New("hmap snapshot: truncated")
+	ErrSnapshotChecksum = errors.New("hmap snapshot: checksum mismatch")
+	ErrSnapshotCorrupt  = errors.New("hmap snapshot: corrupt")
+)
+
+// val的编解码
+type Codec interface {
+	Encode(val interface{}) ([]byte, error)
+	Decode(data []byte) (interface{}, error)
+}
+
+// 默认使用gob编解码，自定义类型需要先gob.Register
+type gobCodec struct{}
+
+func (gobCodec) Encode(val interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&val); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Decode(data []byte) (interface{}, error) {
+	var val interface{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&val); err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+// 设置快照中val的编解码，nil表示使用默认的gob
+func (hm *hmap) SetCodec(codec Codec) {
+	if codec == nil {
+		codec = gobCodec{}
+	}
+	hm.codec = codec
+}
+
+// 将所有元素写入快照，实现io.WriterTo
+// 按桶的顺序写入，不修改元素，正在缩容时会先一次性完成缩容
+func (hm *hmap) WriteTo(w io.Writer) (int64, error) {
+	sw := &snapshotWriter{w: bufio.NewWriter(w), crc: crc32.NewIEEE()}
+	var header [snapshotHeader]byte
+	copy(header[:], snapshotMagic)
+	binary.LittleEndian.PutUint16(header[4:], snapshotVersion)
+	header[6] = hm.b
+	binary.LittleEndian.PutUint64(header[7:], uint64(hm.count))
+	sw.write(header[:])
+
+	it := hm.iterator(0)
+	for sw.err == nil && it.Next() {
+		val, err := hm.codec.Encode(it.Value())
+		if err != nil {
+			return sw.n, err
+		}
+		sw.writeBytes([]byte(it.Key()))
+		sw.writeBytes(val)
+	}
+
+	var footer [4]byte
+	binary.LittleEndian.PutUint32(footer[:], sw.crc.Sum32())
+	sw.crc = nil
+	sw.write(footer[:])
+	if sw.err == nil {
+		sw.err = sw.w.Flush()
+	}
+	return sw.n, sw.err
+}
+
+// 从快照中读取所有元素，替换map中原有的元素，实现io.ReaderFrom
+// 按header中的count预先分配桶，边读边插入新的桶，校验通过后替换map的桶
+// count在校验CRC之前不可信，预先分配不超过maxSnapshotPre
+// 快照不完整或校验失败时返回错误，map保持不变
+// 哈希函数，种子，codec等设置都保持不变
+// 错误可以通过errors.Is判断是ErrSnapshotMagic等哪一种
+func (hm *hmap) ReadFrom(r io.Reader) (int64, error) {
+	sr := &snapshotReader{r: bufio.NewReader(r), crc: crc32.NewIEEE()}
+	var header [snapshotHeader]byte
+	if err := sr.read(header[:]); err != nil {
+		return sr.n, err
+	}
+	if string(header[:4]) != snapshotMagic {
+		return sr.n, ErrSnapshotMagic
+	}
+	if binary.LittleEndian.Uint16(header[4:]) != snapshotVersion {
+		return sr.n, ErrSnapshotVersion
+	}
+	count := binary.LittleEndian.Uint64(header[7:])
+	if header[6] > 63 || count > 1<<30 {
+		return sr.n, ErrSnapshotCorrupt
+	}
+
+	// 只用来存放读取的元素，与hm使用相同的哈希函数，不重新设置种子
+	m := makemap(uint(min(count, maxSnapshotPre)))
+	m.mapHash = hm.mapHash
+	for i := uint64(0); i < count; i++ {
+		key, err := sr.readBytes()
+		if err != nil {
+			return sr.n, err
+		}
+		data, err := sr.readBytes()
+		if err != nil {
+			return sr.n, err
+		}
+		val, err := hm.codec.Decode(data)
+		if err != nil {
+			return sr.n, fmt.Errorf("%w: %v", ErrSnapshotCorrupt, err)
+		}
+		k := string(key)
+		if m.assign(k, val, m.mapHash.Hash(k)) {
+			m.count++
+		}
+	}
+	if uint64(m.count) != count {
+		return sr.n, ErrSnapshotCorrupt
+	}
+
+	sum := sr.crc.Sum32()
+	var footer [4]byte
+	sr.crc = nil
+	if err := sr.read(footer[:]); err != nil {
+		return sr.n, err
+	}
+	if binary.LittleEndian.Uint32(footer[:]) != sum {
+		return sr.n, ErrSnapshotChecksum
+	}
+	hm.resetBuckets(m)
+	return sr.n, nil
+}
+
+// 使用m的桶替换所有元素，结束正在进行的扩容，m与hm的哈希函数必须相同
+func (hm *hmap) resetBuckets(m *hmap) {
+	hm.count = m.count
+	hm.b = m.b
+	hm.bucketCount = m.bucketCount
+	hm.buckets = m.buckets
+	hm.overflowBuckets = m.overflowBuckets
+	hm.oldBuckets = nil
+	hm.oldOverflowBuckets = nil
+	hm.nevacuate = 0
+	hm.shrinking = false
+	hm.noverflow = m.noverflow
+	hm.chain = 0
+}
+
+// 写入时同时计算CRC32，记录第一个错误
+type snapshotWriter struct {
+	w   *bufio.Writer
+	crc hash.Hash32
+	n   int64
+	err error
+}
+
+func (sw *snapshotWriter) write(p []byte) {
+	if sw.err != nil {
+		return
+	}
+	n, err := sw.w.Write(p)
+	sw.n += int64(n)
+	sw.err = err
+	if sw.crc != nil {
+		sw.crc.Write(p)
+	}
+}
+
+// 写入长度前缀和内容
+func (sw *snapshotWriter) writeBytes(p []byte) {
+	var buf [binary.MaxVarintLen64]byte
+	sw.write(buf[:binary.PutUvarint(buf[:], uint64(len(p)))])
+	sw.write(p)
+}
+
+// 读取时同时计算CRC32，读到EOF视为快照不完整
+type snapshotReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+	n   int64
+}
+
+func (sr *snapshotReader) read(p []byte) error {
+	n, err := io.ReadFull(sr.r, p)
+	sr.n += int64(n)
+	if sr.crc != nil {
+		sr.crc.Write(p[:n])
+	}
+	return snapshotError(err)
+}
+
+func (sr *snapshotReader) ReadByte() (byte, error) {
+	var p [1]byte
+	err := sr.read(p[:])
+	return p[0], err
+}
+
+// 读取长度前缀和内容
+// 不按长度预先分配内存，避免损坏的长度分配过多
+func (sr *snapshotReader) readBytes() ([]byte, error) {
+	n, err := binary.ReadUvarint(sr)
+	if err == ErrSnapshotTruncate {
+		return nil, err
+	}
+	if err != nil {
+		// 长度超过uint64
+		return nil, ErrSnapshotCorrupt
+	}
+	if n > maxSnapshotLen {
+		return nil, ErrSnapshotCorrupt
+	}
+	var buf bytes.Buffer
+	copied, err := io.CopyN(&buf, sr.r, int64(n))
+	sr.n += copied
+	if sr.crc != nil {
+		sr.crc.Write(buf.Bytes())
+	}
+	if err != nil {
+		return nil, snapshotError(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// 将EOF转换为ErrSnapshotTruncate
+func snapshotError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrSnapshotTruncate
+	}
+	return err
+}
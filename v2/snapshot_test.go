@@ -0,0 +1,199 @@
+package v2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试快照写入再读取
+func TestSnapshot1(t *testing.T) {
+	assert := assert.New(t)
+	for _, count := range []int{0, 1, 100, 1 << 12} {
+		m := NewHMap(0)
+		for i := 0; i < count; i++ {
+			m.Set(strconv.Itoa(i), i)
+		}
+		m.Set("a", "啊啊啊")
+		m.Set("b", []string{"1", "2"})
+		var buf bytes.Buffer
+		written, err := m.WriteTo(&buf)
+		assert.Nil(err)
+		assert.Equal(int64(buf.Len()), written)
+
+		m2 := NewHMap(0)
+		m2.Set("x", 1)
+		read, err := m2.ReadFrom(&buf)
+		assert.Nil(err)
+		assert.Equal(written, read)
+		assert.Equal(count+2, m2.Count())
+		assert.Equal(capb(uint(count+2)), m2.b)
+		_, ok := m2.Get("x")
+		assert.False(ok)
+		for i := 0; i < count; i++ {
+			val, ok := m2.Get(strconv.Itoa(i))
+			assert.True(ok, i)
+			assert.Equal(i, val, i)
+		}
+		val, _ := m2.Get("a")
+		assert.Equal("啊啊啊", val)
+		val, _ = m2.Get("b")
+		assert.Equal([]string{"1", "2"}, val)
+	}
+}
+
+// 测试快照的header
+func TestSnapshotHeader(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(1 << 10)
+	m.Set("a", 1)
+	var buf bytes.Buffer
+	_, err := m.WriteTo(&buf)
+	assert.Nil(err)
+	data := buf.Bytes()
+	assert.Equal(snapshotMagic, string(data[:4]))
+	assert.Equal(uint16(snapshotVersion), binary.LittleEndian.Uint16(data[4:]))
+	assert.Equal(uint8(7), data[6])
+	assert.Equal(uint64(1), binary.LittleEndian.Uint64(data[7:]))
+
+	table := []struct {
+		offset int
+		b      byte
+		err    error
+	}{
+		{0, 'X', ErrSnapshotMagic},
+		{4, 2, ErrSnapshotVersion},
+		{6, 64, ErrSnapshotCorrupt},
+		{14, 0xff, ErrSnapshotCorrupt},
+	}
+	for _, v := range table {
+		bad := append([]byte{}, data...)
+		bad[v.offset] = v.b
+		_, err := NewHMap(0).ReadFrom(bytes.NewReader(bad))
+		assert.True(errors.Is(err, v.err), v.offset, err)
+	}
+}
+
+// 测试不完整和损坏的快照，map保持不变
+func TestSnapshotCorrupt(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(0)
+	for i := 0; i < 20; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	var buf bytes.Buffer
+	_, err := m.WriteTo(&buf)
+	assert.Nil(err)
+	data := buf.Bytes()
+
+	m2 := NewHMap(0)
+	m2.Set("x", 1)
+	// 每个位置截断
+	for i := 0; i < len(data); i++ {
+		_, err := m2.ReadFrom(bytes.NewReader(data[:i]))
+		assert.True(errors.Is(err, ErrSnapshotTruncate), i, err)
+	}
+	// 每个位置修改一个字节
+	for i := 0; i < len(data); i++ {
+		bad := append([]byte{}, data...)
+		bad[i] ^= 0x40
+		_, err := m2.ReadFrom(bytes.NewReader(bad))
+		typed := errors.Is(err, ErrSnapshotMagic) || errors.Is(err, ErrSnapshotVersion) ||
+			errors.Is(err, ErrSnapshotTruncate) || errors.Is(err, ErrSnapshotChecksum) ||
+			errors.Is(err, ErrSnapshotCorrupt)
+		assert.True(typed, i, err)
+	}
+	assert.Equal(1, m2.Count())
+	val, ok := m2.Get("x")
+	assert.True(ok)
+	assert.Equal(1, val)
+}
+
+// header中的count很大但没有entry，不按count预先分配
+func TestSnapshotHugeCount(t *testing.T) {
+	assert := assert.New(t)
+	var header [snapshotHeader]byte
+	copy(header[:], snapshotMagic)
+	binary.LittleEndian.PutUint16(header[4:], snapshotVersion)
+	binary.LittleEndian.PutUint64(header[7:], 1<<30)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := NewHMap(0).ReadFrom(bytes.NewReader(header[:]))
+	runtime.ReadMemStats(&after)
+	assert.True(errors.Is(err, ErrSnapshotTruncate), err)
+	assert.Less(after.TotalAlloc-before.TotalAlloc, uint64(64<<20))
+}
+
+type stringCodec struct{}
+
+func (stringCodec) Encode(val interface{}) ([]byte, error) {
+	return []byte(val.(string)), nil
+}
+
+func (stringCodec) Decode(data []byte) (interface{}, error) {
+	return string(data), nil
+}
+
+// 测试自定义编解码
+func TestSnapshotCodec(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(0)
+	m.SetCodec(stringCodec{})
+	m.Set("a", "1")
+	m.Set("b", "22")
+	var buf bytes.Buffer
+	_, err := m.WriteTo(&buf)
+	assert.Nil(err)
+	// header + 2个entry + crc32
+	assert.Equal(snapshotHeader+(1+1+1+1)+(1+1+1+2)+4, buf.Len())
+
+	m2 := NewHMap(0)
+	m2.SetCodec(stringCodec{})
+	_, err = m2.ReadFrom(&buf)
+	assert.Nil(err)
+	val, _ := m2.Get("b")
+	assert.Equal("22", val)
+	m2.SetCodec(nil)
+	assert.Equal(gobCodec{}, m2.codec)
+}
+
+// 读取快照只替换元素，哈希函数和其他设置不变，正在进行的扩容结束
+func TestSnapshotKeepSettings(t *testing.T) {
+	assert := assert.New(t)
+	m := NewHMap(0)
+	for i := 0; i < 100; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	var buf bytes.Buffer
+	_, err := m.WriteTo(&buf)
+	assert.Nil(err)
+
+	var events []ReseedEvent
+	m2 := NewHMap(0, WithSeed(7), WithReseedHook(func(e ReseedEvent) {
+		events = append(events, e)
+	}))
+	for i := 0; !m2.growing(); i++ {
+		m2.Set("x"+strconv.Itoa(i), i)
+	}
+	mapHash, id := m2.mapHash, m2.hashID
+	kh := m2.HashKey("1")
+	_, err = m2.ReadFrom(&buf)
+	assert.Nil(err)
+	assert.False(m2.growing())
+	assert.Nil(m2.oldBuckets)
+	assert.Equal(100, m2.Count())
+	assert.True(m2.Deterministic())
+	assert.Equal(mapHash, m2.mapHash)
+	assert.True(id == m2.hashID)
+	val, ok := m2.GetHashed("1", kh)
+	assert.True(ok)
+	assert.Equal(1, val)
+	assert.Equal(uint64(0), m2.HashMismatches())
+	assert.NotNil(m2.onReseed)
+	assert.Empty(events)
+}
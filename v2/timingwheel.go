@@ -0,0 +1,167 @@
+package v2
+
+import (
+	"math/bits"
+)
+
+// 分层时间轮，每层64个槽位，第l层每个槽位跨度为64^l个刻度
+// 元素按距离过期的刻度数放到合适的层，低层转完一圈时，将高层对应槽位的元素重新放到低层
+// 到期的元素放入ready链表，等待清理
+// 每层用一个bitmap记录非空的槽位，前进时直接跳到下一个需要处理的刻度
+const (
+	wheelBits   = 6
+	wheelSlots  = 1 << wheelBits
+	wheelMask   = wheelSlots - 1
+	wheelLevels = 6
+	wheelSpan   = 1 << (wheelBits * wheelLevels) // 最大跨度，超过的元素先放在最高层，重新放置时再判断
+)
+
+type timingWheel struct {
+	base     int64 // 刻度0对应的时间，UnixNano
+	tick     int64 // 每个刻度的时间
+	cur      int64 // 当前刻度，之前的刻度都已处理
+	levels   [wheelLevels][wheelSlots]ttlList
+	occupied [wheelLevels]uint64 // 非空的槽位
+	ready    ttlList             // 已到期的元素
+}
+
+func (w *timingWheel) init(now int64, tick int64) {
+	w.base = now
+	w.tick = tick
+	for l := range w.levels {
+		for s := range w.levels[l] {
+			w.levels[l][s].init(l, s)
+		}
+	}
+	w.ready.init(-1, 0)
+}
+
+// 放入时间轮，不过期的元素不放入
+func (w *timingWheel) add(e *ttlEntry) {
+	if e.expire == 0 {
+		return
+	}
+	// 向上取整，保证处理到该刻度时已经过期
+	d := e.expire - w.base
+	e.tick = d / w.tick
+	if d%w.tick > 0 {
+		e.tick++
+	}
+	w.place(e)
+}
+
+func (w *timingWheel) place(e *ttlEntry) {
+	delta := e.tick - w.cur
+	if delta <= 0 {
+		w.ready.push(e)
+		return
+	}
+	tick := e.tick
+	if delta >= wheelSpan {
+		tick = w.cur + wheelSpan - 1
+		delta = wheelSpan - 1
+	}
+	l := 0
+	for delta >= 1<<(wheelBits*(l+1)) {
+		l++
+	}
+	s := tick >> (wheelBits * l) & wheelMask
+	w.levels[l][s].push(e)
+	w.occupied[l] |= 1 << s
+}
+
+func (w *timingWheel) remove(e *ttlEntry) {
+	list := e.list
+	if list == nil {
+		return
+	}
+	list.remove(e)
+	if list.level >= 0 && list.front() == nil {
+		w.occupied[list.level] &^= 1 << list.slot
+	}
+}
+
+// 前进到下一个需要处理的刻度，已经到达now时返回false
+// 先将高层到期槽位的元素重新放置，再将第0层当前槽位的元素放入ready
+func (w *timingWheel) advance(now int64) bool {
+	nowTick := (now - w.base) / w.tick
+	if w.cur >= nowTick {
+		return false
+	}
+	next := w.next()
+	if next > nowTick {
+		w.cur = nowTick
+		return false
+	}
+	w.cur = next
+	for l := wheelLevels - 1; l > 0; l-- {
+		if w.cur&(1<<(wheelBits*l)-1) != 0 {
+			continue
+		}
+		slot := &w.levels[l][w.cur>>(wheelBits*l)&wheelMask]
+		for e := slot.front(); e != nil; e = slot.front() {
+			w.remove(e)
+			w.place(e)
+		}
+	}
+	slot := &w.levels[0][w.cur&wheelMask]
+	for e := slot.front(); e != nil; e = slot.front() {
+		w.remove(e)
+		w.ready.push(e)
+	}
+	return true
+}
+
+// 下一个需要处理的刻度：第0层的非空槽位，或者高层非空槽位开始的刻度
+// 所有层都为空时返回最大值
+func (w *timingWheel) next() int64 {
+	next := int64(1<<63 - 1)
+	for l := 0; l < wheelLevels; l++ {
+		if w.occupied[l] == 0 {
+			continue
+		}
+		shift := wheelBits * l
+		block := w.cur >> shift
+		// 当前槽位之后第一个非空槽位的距离，当前槽位本身表示转一圈
+		d := int64(bits.TrailingZeros64(bits.RotateLeft64(w.occupied[l], -int(block&wheelMask+1)))) + 1
+		if t := (block + d) << shift; t < next {
+			next = t
+		}
+	}
+	return next
+}
+
+// 时间轮槽位中的双向链表
+type ttlList struct {
+	root  ttlEntry
+	level int // 所在的层，ready为-1
+	slot  int
+}
+
+func (list *ttlList) init(level int, slot int) {
+	list.root.prev = &list.root
+	list.root.next = &list.root
+	list.level = level
+	list.slot = slot
+}
+
+func (list *ttlList) front() *ttlEntry {
+	if list.root.next == &list.root {
+		return nil
+	}
+	return list.root.next
+}
+
+func (list *ttlList) push(e *ttlEntry) {
+	e.prev = list.root.prev
+	e.next = &list.root
+	list.root.prev.next = e
+	list.root.prev = e
+	e.list = list
+}
+
+func (list *ttlList) remove(e *ttlEntry) {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	e.prev, e.next, e.list = nil, nil, nil
+}
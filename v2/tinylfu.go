@@ -0,0 +1,237 @@
+package v2
+
+// W-TinyLFU缓存，新元素先进入1%容量的窗口LRU
+// 窗口满时淘汰的元素作为候选，与主LRU试用段的尾部比较访问频率，频率更高的留下
+// 主LRU分为试用段和保护段，保护段占80%，试用段中再次访问的元素进入保护段
+// 访问频率由count-min sketch估计，使用hmap的哈希值作为下标，定期减半
+// 一次性扫描的key频率低，不会挤掉经常访问的元素
+// 不支持并发安全
+type TinyLFUCache struct {
+	hm           *hmap
+	window       tlfuList
+	probation    tlfuList
+	protected    tlfuList
+	sketch       *cmSketch
+	reseeds      uint64 // hmap重新设置种子后哈希值改变，清空sketch
+	maxEntries   int
+	maxWindow    int
+	maxProtected int
+	onEvict      func(key string, val interface{})
+}
+
+const (
+	segWindow = iota
+	segProbation
+	segProtected
+)
+
+type tlfuEntry struct {
+	key        string
+	val        interface{}
+	seg        uint8
+	prev, next *tlfuEntry
+}
+
+// maxEntries为最大元素个数，onEvict在元素被淘汰或者没有被接纳时调用，可以为nil
+func NewTinyLFUCache(maxEntries int, onEvict func(key string, val interface{}), opts ...Option) *TinyLFUCache {
+	if maxEntries <= 0 || maxEntries > 1<<30 {
+		panic("max entries error")
+	}
+	c := &TinyLFUCache{
+		hm:         NewHMap(maxEntries, opts...),
+		sketch:     newCMSketch(maxEntries),
+		maxEntries: maxEntries,
+		onEvict:    onEvict,
+	}
+	c.maxWindow = maxEntries / 100
+	if c.maxWindow == 0 {
+		c.maxWindow = 1
+	}
+	c.maxProtected = (maxEntries - c.maxWindow) * 8 / 10
+	c.window.init()
+	c.probation.init()
+	c.protected.init()
+	return c
+}
+
+// 插入或更新，返回是否淘汰了元素，淘汰的可能是刚插入的元素
+func (c *TinyLFUCache) Set(key string, val interface{}) bool {
+	hash := c.hash(key)
+	c.sketch.increment(hash)
+	if v, ok := c.hm.lookup(key, hash); ok {
+		e := v.(*tlfuEntry)
+		e.val = val
+		c.touch(e)
+		return false
+	}
+	e := &tlfuEntry{key: key, val: val, seg: segWindow}
+	if c.hm.assign(key, e, hash) {
+		c.hm.count++
+		c.hm.checkFlood()
+	}
+	c.window.pushFront(e)
+	if c.window.len <= c.maxWindow {
+		return false
+	}
+	// 窗口满，尾部的元素进入主LRU
+	candidate := c.window.back()
+	c.window.remove(candidate)
+	candidate.seg = segProbation
+	c.probation.pushFront(candidate)
+	if c.hm.Count() <= c.maxEntries {
+		return false
+	}
+	victim := c.probation.back()
+	if victim == candidate {
+		// 主LRU容量为0
+		c.evict(candidate)
+		return true
+	}
+	if c.sketch.estimate(c.hash(candidate.key)) > c.sketch.estimate(c.hash(victim.key)) {
+		c.evict(victim)
+	} else {
+		c.evict(candidate)
+	}
+	return true
+}
+
+// 查找，命中时记录访问并调整位置，未命中也记录访问频率
+func (c *TinyLFUCache) Get(key string) (interface{}, bool) {
+	hash := c.hash(key)
+	c.sketch.increment(hash)
+	v, ok := c.hm.lookup(key, hash)
+	if !ok {
+		return nil, false
+	}
+	e := v.(*tlfuEntry)
+	c.touch(e)
+	return e.val, true
+}
+
+// 查找，不记录访问
+func (c *TinyLFUCache) Peek(key string) (interface{}, bool) {
+	v, ok := c.hm.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return v.(*tlfuEntry).val, true
+}
+
+// 删除key，不调用onEvict，返回key是否存在
+func (c *TinyLFUCache) Remove(key string) bool {
+	v, ok := c.hm.Get(key)
+	if !ok {
+		return false
+	}
+	e := v.(*tlfuEntry)
+	c.list(e.seg).remove(e)
+	c.hm.Delete(key)
+	return true
+}
+
+func (c *TinyLFUCache) Len() int {
+	return c.hm.Count()
+}
+
+func (c *TinyLFUCache) Cap() int {
+	return c.maxEntries
+}
+
+// 删除所有元素，不调用onEvict，保留访问频率
+func (c *TinyLFUCache) Purge() {
+	for _, l := range []*tlfuList{&c.window, &c.probation, &c.protected} {
+		for e := l.back(); e != nil; e = l.back() {
+			l.remove(e)
+			c.hm.Delete(e.key)
+		}
+	}
+}
+
+// 使用hmap当前的哈希函数，重新设置种子后之前的频率失效
+func (c *TinyLFUCache) hash(key string) uint64 {
+	if r := c.hm.Reseeds(); r != c.reseeds {
+		c.reseeds = r
+		c.sketch.clear()
+	}
+	return c.hm.mapHash.Hash(key)
+}
+
+// 命中后调整位置，试用段的元素进入保护段，保护段满时尾部降级到试用段
+func (c *TinyLFUCache) touch(e *tlfuEntry) {
+	switch e.seg {
+	case segWindow:
+		c.window.moveToFront(e)
+	case segProbation:
+		c.probation.remove(e)
+		e.seg = segProtected
+		c.protected.pushFront(e)
+		if c.protected.len > c.maxProtected {
+			demoted := c.protected.back()
+			c.protected.remove(demoted)
+			demoted.seg = segProbation
+			c.probation.pushFront(demoted)
+		}
+	case segProtected:
+		c.protected.moveToFront(e)
+	}
+}
+
+func (c *TinyLFUCache) evict(e *tlfuEntry) {
+	c.list(e.seg).remove(e)
+	c.hm.Delete(e.key)
+	if c.onEvict != nil {
+		c.onEvict(e.key, e.val)
+	}
+}
+
+func (c *TinyLFUCache) list(seg uint8) *tlfuList {
+	switch seg {
+	case segWindow:
+		return &c.window
+	case segProbation:
+		return &c.probation
+	default:
+		return &c.protected
+	}
+}
+
+// 带哨兵节点的双向链表，root.next为头部，root.prev为尾部
+type tlfuList struct {
+	root tlfuEntry
+	len  int
+}
+
+func (l *tlfuList) init() {
+	l.root.prev = &l.root
+	l.root.next = &l.root
+}
+
+func (l *tlfuList) back() *tlfuEntry {
+	if l.root.prev == &l.root {
+		return nil
+	}
+	return l.root.prev
+}
+
+func (l *tlfuList) pushFront(e *tlfuEntry) {
+	e.prev = &l.root
+	e.next = l.root.next
+	l.root.next.prev = e
+	l.root.next = e
+	l.len++
+}
+
+func (l *tlfuList) remove(e *tlfuEntry) {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	e.prev, e.next = nil, nil
+	l.len--
+}
+
+func (l *tlfuList) moveToFront(e *tlfuEntry) {
+	if l.root.next == e {
+		return
+	}
+	l.remove(e)
+	l.pushFront(e)
+}
@@ -0,0 +1,187 @@
+package v2
+
+import (
+	"bufio"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSketch(t *testing.T) {
+	assert := assert.New(t)
+	s := newCMSketch(100)
+	assert.Equal(uint64(128), s.width)
+	h := NewHMap(0)
+	for i := 0; i < 10; i++ {
+		s.increment(h.mapHash.Hash("a"))
+	}
+	s.increment(h.mapHash.Hash("b"))
+	assert.Equal(10, s.estimate(h.mapHash.Hash("a")))
+	assert.Equal(1, s.estimate(h.mapHash.Hash("b")))
+	assert.Equal(0, s.estimate(h.mapHash.Hash("c")))
+	// 计数最大为15
+	for i := 0; i < 10; i++ {
+		s.increment(h.mapHash.Hash("a"))
+	}
+	assert.Equal(sketchMax, s.estimate(h.mapHash.Hash("a")))
+
+	// 增加的次数达到sample时减半
+	for i := 0; ; i++ {
+		prev := s.additions
+		s.increment(h.mapHash.Hash(strconv.Itoa(i)))
+		if s.additions < prev {
+			break
+		}
+	}
+	assert.Equal(7, s.estimate(h.mapHash.Hash("a")))
+}
+
+func TestTinyLFU1(t *testing.T) {
+	assert := assert.New(t)
+	var evicted []string
+	c := NewTinyLFUCache(100, func(key string, val interface{}) {
+		evicted = append(evicted, key)
+	})
+	assert.Equal(1, c.maxWindow)
+	assert.Equal(79, c.maxProtected)
+	for i := 0; i < 100; i++ {
+		assert.False(c.Set(strconv.Itoa(i), i))
+	}
+	// 频繁访问的key进入保护段
+	for j := 0; j < 3; j++ {
+		for i := 0; i < 50; i++ {
+			val, ok := c.Get(strconv.Itoa(i))
+			assert.True(ok)
+			assert.Equal(i, val)
+		}
+	}
+	assert.Equal(50, c.protected.len)
+	// 只访问一次的新key不能挤掉已有的key
+	for i := 100; i < 200; i++ {
+		assert.True(c.Set(strconv.Itoa(i), i))
+	}
+	assert.Equal(100, c.Len())
+	assert.Len(evicted, 100)
+	for i := 0; i < 50; i++ {
+		_, ok := c.Peek(strconv.Itoa(i))
+		assert.True(ok, i)
+	}
+
+	// 更新
+	assert.False(c.Set("0", 100))
+	val, _ := c.Peek("0")
+	assert.Equal(100, val)
+	assert.True(c.Remove("0"))
+	assert.False(c.Remove("0"))
+	assert.Equal(99, c.Len())
+	assert.Equal(99, c.window.len+c.probation.len+c.protected.len)
+	c.Purge()
+	assert.Equal(0, c.Len())
+	assert.Equal(0, c.window.len+c.probation.len+c.protected.len)
+}
+
+func TestTinyLFUSmall(t *testing.T) {
+	assert := assert.New(t)
+	for _, n := range []int{1, 2, 3} {
+		c := NewTinyLFUCache(n, nil)
+		for i := 0; i < 100; i++ {
+			c.Set(strconv.Itoa(i%7), i)
+			c.Get(strconv.Itoa(i % 5))
+			assert.LessOrEqual(c.Len(), n)
+			assert.Equal(c.Len(), c.window.len+c.probation.len+c.protected.len)
+		}
+	}
+}
+
+// 缓存的读写接口，用于比较命中率
+type hitCache interface {
+	Get(key string) (interface{}, bool)
+	Set(key string, val interface{}) bool
+}
+
+// 按trace访问，未命中时写入，返回命中率
+func hitRatio(c hitCache, trace []string) float64 {
+	hits := 0
+	for _, key := range trace {
+		if _, ok := c.Get(key); ok {
+			hits++
+		} else {
+			c.Set(key, nil)
+		}
+	}
+	return float64(hits) / float64(len(trace))
+}
+
+// 读取testdata中的trace，gzip压缩，每行一个key
+// 不是实际采集的访问记录，synthetic-zipf-<s>.trace.gz为rand.NewZipf(rand.New(rand.NewSource(n)), s, 1, 99999)
+// 生成的10万次访问，保存下来避免math/rand的实现变化影响命中率，s为1.01时n为1，s为1.2时n为2
+func readTrace(t *testing.T, name string) []string {
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trace []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		trace = append(trace, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return trace
+}
+
+// 每隔scan次访问插入scan/2个只访问一次的key
+func withScan(trace []string, scan int) []string {
+	if scan == 0 {
+		return trace
+	}
+	mixed := make([]string, 0, len(trace)*3/2)
+	next := 0
+	for i, key := range trace {
+		if i%scan == 0 {
+			for j := 0; j < scan/2; j++ {
+				mixed = append(mixed, "scan"+strconv.Itoa(next))
+				next++
+			}
+		}
+		mixed = append(mixed, key)
+	}
+	return mixed
+}
+
+// Zipf分布下命中率高于LRU，有扫描时差距更大
+// 使用固定的种子，sketch的冲突每次相同，命中率是确定的
+// 阈值低于种子0到29中最低的命中率，更换哈希函数也不容易失败
+func TestTinyLFUHitRatio(t *testing.T) {
+	assert := assert.New(t)
+	table := []struct {
+		trace  string
+		scan   int
+		size   int
+		minLFU float64 // TinyLFU的最低命中率
+		minGap float64 // 比LRU至少高出的命中率
+	}{
+		{"synthetic-zipf-1.01.trace.gz", 0, 1000, 0.57, 0.05},
+		{"synthetic-zipf-1.2.trace.gz", 0, 1000, 0.81, 0.02},
+		{"synthetic-zipf-1.01.trace.gz", 2000, 1000, 0.35, 0.05},
+		{"synthetic-zipf-1.2.trace.gz", 2000, 1000, 0.5, 0.04},
+	}
+	for i, v := range table {
+		trace := withScan(readTrace(t, v.trace), v.scan)
+		lfu := hitRatio(NewTinyLFUCache(v.size, nil, WithSeed(1)), trace)
+		lru := hitRatio(NewLRUCache(v.size, nil), trace)
+		t.Logf("%v scan=%v tinylfu=%.4f lru=%.4f", v.trace, v.scan, lfu, lru)
+		assert.GreaterOrEqual(lfu, v.minLFU, i)
+		assert.GreaterOrEqual(lfu-lru, v.minGap, i)
+	}
+}
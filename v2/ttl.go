@@ -0,0 +1,189 @@
+package v2
+
+import (
+	"time"
+)
+
+// 当前时间，测试时可以替换
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+const (
+	defaultTTLTick  = 10 * time.Millisecond
+	defaultTTLBatch = 16
+)
+
+type ExpiringOptions struct {
+	Clock    Clock                             // 默认使用系统时间
+	Tick     time.Duration                     // 时间轮的精度，默认10ms
+	Batch    int                               // 每次Set，Get，Delete时最多清理的过期元素个数，默认16，小于0时不自动清理
+	OnExpire func(key string, val interface{}) // 元素过期被删除时调用
+	Cap      int                               // map的预设容量
+}
+
+// 带过期时间的map
+// Get时发现过期直接删除，同时用分层时间轮记录过期时间，每次操作顺带清理一批已过期的元素
+// 也可以调用Purge主动清理，不使用后台goroutine，不支持并发安全
+type ExpiringMap struct {
+	hm       *hmap // val为*ttlEntry
+	wheel    timingWheel
+	clock    Clock
+	batch    int
+	onExpire func(key string, val interface{})
+}
+
+type ttlEntry struct {
+	key        string
+	val        interface{}
+	expire     int64 // 过期时间，UnixNano，0表示不过期
+	tick       int64 // 过期时间对应的时间轮刻度，向上取整
+	prev, next *ttlEntry
+	list       *ttlList // 所在的时间轮槽位
+}
+
+func NewExpiringMap(opts *ExpiringOptions) *ExpiringMap {
+	var o ExpiringOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Clock == nil {
+		o.Clock = systemClock{}
+	}
+	if o.Tick <= 0 {
+		o.Tick = defaultTTLTick
+	}
+	if o.Batch == 0 {
+		o.Batch = defaultTTLBatch
+	}
+	em := &ExpiringMap{
+		hm:       NewHMap(o.Cap),
+		clock:    o.Clock,
+		batch:    o.Batch,
+		onExpire: o.OnExpire,
+	}
+	em.wheel.init(o.Clock.Now().UnixNano(), int64(o.Tick))
+	return em
+}
+
+// 插入或更新，不过期
+func (em *ExpiringMap) Set(key string, val interface{}) {
+	em.set(key, val, 0)
+}
+
+// 插入或更新，ttl之后过期，ttl不大于0时立即过期
+func (em *ExpiringMap) SetWithTTL(key string, val interface{}, ttl time.Duration) {
+	expire := em.clock.Now().Add(ttl).UnixNano()
+	if expire == 0 {
+		expire = 1
+	}
+	em.set(key, val, expire)
+}
+
+func (em *ExpiringMap) set(key string, val interface{}, expire int64) {
+	hash := em.hm.mapHash.Hash(key)
+	if v, ok := em.hm.lookup(key, hash); ok {
+		e := v.(*ttlEntry)
+		e.val = val
+		em.wheel.remove(e)
+		e.expire = expire
+		em.wheel.add(e)
+	} else {
+		e := &ttlEntry{key: key, val: val, expire: expire}
+		em.hm.assign(key, e, hash)
+		em.hm.count++
+		em.hm.checkFlood()
+		em.wheel.add(e)
+	}
+	em.autoPurge()
+}
+
+// 已过期的元素直接删除，返回不存在
+func (em *ExpiringMap) Get(key string) (interface{}, bool) {
+	v, ok := em.hm.Get(key)
+	if !ok {
+		em.autoPurge()
+		return nil, false
+	}
+	e := v.(*ttlEntry)
+	if e.expired(em.clock.Now().UnixNano()) {
+		em.expire(e)
+		em.autoPurge()
+		return nil, false
+	}
+	em.autoPurge()
+	return e.val, true
+}
+
+// 剩余的过期时间，不过期时返回0
+func (em *ExpiringMap) TTL(key string) (time.Duration, bool) {
+	v, ok := em.hm.Get(key)
+	if !ok {
+		return 0, false
+	}
+	e := v.(*ttlEntry)
+	now := em.clock.Now().UnixNano()
+	if e.expired(now) {
+		return 0, false
+	}
+	if e.expire == 0 {
+		return 0, true
+	}
+	return time.Duration(e.expire - now), true
+}
+
+// 删除，不调用OnExpire
+func (em *ExpiringMap) Delete(key string) {
+	if v, ok := em.hm.Get(key); ok {
+		em.wheel.remove(v.(*ttlEntry))
+		em.hm.Delete(key)
+	}
+	em.autoPurge()
+}
+
+// 元素个数，包括已过期但还未清理的元素
+func (em *ExpiringMap) Count() int {
+	return em.hm.Count()
+}
+
+// 清理最多max个已过期的元素，返回清理的个数
+func (em *ExpiringMap) Purge(max int) int {
+	now := em.clock.Now().UnixNano()
+	n := 0
+	for n < max {
+		e := em.wheel.ready.front()
+		if e == nil {
+			if !em.wheel.advance(now) {
+				break
+			}
+			continue
+		}
+		em.expire(e)
+		n++
+	}
+	return n
+}
+
+func (em *ExpiringMap) autoPurge() {
+	if em.batch > 0 {
+		em.Purge(em.batch)
+	}
+}
+
+func (em *ExpiringMap) expire(e *ttlEntry) {
+	em.wheel.remove(e)
+	em.hm.Delete(e.key)
+	if em.onExpire != nil {
+		em.onExpire(e.key, e.val)
+	}
+}
+
+func (e *ttlEntry) expired(now int64) bool {
+	return e.expire != 0 && now >= e.expire
+}
@@ -0,0 +1,155 @@
+package v2
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1700000000, 0)}
+}
+
+func TestExpiring1(t *testing.T) {
+	assert := assert.New(t)
+	clock := newFakeClock()
+	var expired []string
+	em := NewExpiringMap(&ExpiringOptions{Clock: clock, Batch: -1, OnExpire: func(key string, val interface{}) {
+		expired = append(expired, key)
+	}})
+	em.SetWithTTL("a", 1, time.Second)
+	em.SetWithTTL("b", 2, 2*time.Second)
+	em.Set("c", 3)
+	clock.Add(999 * time.Millisecond)
+	val, ok := em.Get("a")
+	assert.True(ok)
+	assert.Equal(1, val)
+	ttl, ok := em.TTL("a")
+	assert.True(ok)
+	assert.Equal(time.Millisecond, ttl)
+	ttl, ok = em.TTL("c")
+	assert.True(ok)
+	assert.Equal(time.Duration(0), ttl)
+
+	// Get时发现过期
+	clock.Add(time.Millisecond)
+	_, ok = em.Get("a")
+	assert.False(ok)
+	assert.Equal([]string{"a"}, expired)
+	assert.Equal(2, em.Count())
+
+	// 更新后重新计算过期时间
+	em.SetWithTTL("b", 20, 2*time.Second)
+	clock.Add(1500 * time.Millisecond)
+	assert.Equal(0, em.Purge(100))
+	val, _ = em.Get("b")
+	assert.Equal(20, val)
+	clock.Add(500 * time.Millisecond)
+	assert.Equal(1, em.Purge(100))
+	assert.Equal([]string{"a", "b"}, expired)
+
+	// 不过期的元素和Delete
+	clock.Add(24 * time.Hour)
+	assert.Equal(0, em.Purge(100))
+	val, _ = em.Get("c")
+	assert.Equal(3, val)
+	em.SetWithTTL("d", 4, time.Second)
+	em.Delete("d")
+	clock.Add(time.Second)
+	assert.Equal(0, em.Purge(100))
+	assert.Equal([]string{"a", "b"}, expired)
+
+	// ttl不大于0时立即过期
+	em.SetWithTTL("e", 5, 0)
+	_, ok = em.Get("e")
+	assert.False(ok)
+	_, ok = em.TTL("e")
+	assert.False(ok)
+}
+
+// 测试每次最多清理max个，操作时自动清理一批
+func TestExpiringBatch(t *testing.T) {
+	assert := assert.New(t)
+	clock := newFakeClock()
+	em := NewExpiringMap(&ExpiringOptions{Clock: clock, Batch: -1})
+	for i := 0; i < 100; i++ {
+		em.SetWithTTL(strconv.Itoa(i), i, time.Minute)
+	}
+	clock.Add(time.Minute)
+	assert.Equal(10, em.Purge(10))
+	assert.Equal(90, em.Count())
+	assert.Equal(90, em.Purge(1000))
+	assert.Equal(0, em.Count())
+
+	em = NewExpiringMap(&ExpiringOptions{Clock: clock})
+	for i := 0; i < 100; i++ {
+		em.SetWithTTL(strconv.Itoa(i), i, time.Minute)
+	}
+	em.Set("x", 1)
+	clock.Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		em.Get("x")
+	}
+	assert.Equal(101-3*defaultTTLBatch, em.Count())
+}
+
+// 随机的过期时间跨越多层时间轮，每次前进后清理的元素与预期一致
+func TestExpiringWheel(t *testing.T) {
+	assert := assert.New(t)
+	clock := newFakeClock()
+	tick := time.Millisecond
+	expired := make(map[string]bool)
+	em := NewExpiringMap(&ExpiringOptions{Clock: clock, Tick: tick, Batch: -1, OnExpire: func(key string, val interface{}) {
+		expired[key] = true
+	}})
+	r := rand.New(rand.NewSource(1))
+	expire := make(map[string]time.Time)
+	for i := 0; i < 5000; i++ {
+		key := strconv.Itoa(i)
+		// 最长约12天，跨越第0到4层
+		ttl := time.Duration(r.Int63n(1<<(6*5))) * tick
+		em.SetWithTTL(key, i, ttl)
+		expire[key] = clock.now.Add(ttl)
+	}
+	for step := 0; step < 200; step++ {
+		clock.Add(time.Duration(r.Int63n(1<<24)) * tick)
+		em.Purge(1 << 30)
+		for key, at := range expire {
+			assert.Equal(!clock.now.Before(at), expired[key], key)
+			_, ok := em.hm.Get(key)
+			assert.Equal(clock.now.Before(at), ok, key)
+		}
+	}
+	assert.Equal(0, em.Count())
+	assert.Len(expired, 5000)
+}
+
+// 超过时间轮最大跨度的过期时间
+func TestExpiringFar(t *testing.T) {
+	assert := assert.New(t)
+	clock := newFakeClock()
+	em := NewExpiringMap(&ExpiringOptions{Clock: clock, Tick: time.Microsecond, Batch: -1})
+	ttl := time.Duration(wheelSpan)*time.Microsecond*3 + time.Second
+	em.SetWithTTL("a", 1, ttl)
+	for d := time.Duration(0); d < ttl-time.Hour; d += time.Hour {
+		clock.Add(time.Hour)
+		assert.Equal(0, em.Purge(10))
+	}
+	clock.now = time.Unix(1700000000, 0).Add(ttl)
+	assert.Equal(1, em.Purge(10))
+}
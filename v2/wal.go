@@ -0,0 +1,288 @@
+package v2
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 文件系统接口，默认使用os，测试时可以替换为内存实现，模拟崩溃
+type FS interface {
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	Remove(name string) error
+	Rename(oldname, newname string) error
+	MkdirAll(dir string) error
+	ReadDir(dir string) ([]string, error) // 返回目录下所有文件名
+}
+
+type File interface {
+	io.Reader
+	io.Writer
+	io.Closer
+	Sync() error
+	Truncate(size int64) error
+}
+
+type osFS struct{}
+
+func (osFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (osFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (osFS) Rename(oldname, newname string) error {
+	return os.Rename(oldname, newname)
+}
+
+func (osFS) MkdirAll(dir string) error {
+	return os.MkdirAll(dir, 0o755)
+}
+
+func (osFS) ReadDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names, nil
+}
+
+// WAL记录格式，整数均为小端序
+//
+//	record:  crc32[4] len[4] payload，crc32为payload的CRC32(IEEE)
+//	payload: op[1] keyLen[uvarint] key val，val为编码后的值，只有walSet有
+const (
+	walSet         = 1
+	walDelete      = 2
+	walHeader      = 4 + 4
+	walSegmentFmt  = "wal-%016d.log"
+	snapshotFmt    = "snapshot-%016d"
+	maxWALRecord   = 1 << 31
+	defaultSegment = 64 << 20
+)
+
+var (
+	ErrWALCorrupt = errors.New("hmap wal: corrupt record")
+	ErrWALClosed  = errors.New("hmap wal: closed")
+)
+
+// WAL中的一条修改
+type walRecord struct {
+	op  byte
+	key string
+	val []byte
+}
+
+func (rec *walRecord) encode() []byte {
+	payload := make([]byte, 0, 1+binary.MaxVarintLen64+len(rec.key)+len(rec.val))
+	payload = append(payload, rec.op)
+	payload = binary.AppendUvarint(payload, uint64(len(rec.key)))
+	payload = append(payload, rec.key...)
+	payload = append(payload, rec.val...)
+
+	buf := make([]byte, walHeader, walHeader+len(payload))
+	binary.LittleEndian.PutUint32(buf, crc32.ChecksumIEEE(payload))
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(payload)))
+	return append(buf, payload...)
+}
+
+// 从data开头解析一条记录，返回记录和长度
+// 数据不完整或校验失败时返回false
+func decodeWALRecord(data []byte) (walRecord, int, bool) {
+	if len(data) < walHeader {
+		return walRecord{}, 0, false
+	}
+	n := binary.LittleEndian.Uint32(data[4:])
+	if n > maxWALRecord || uint64(len(data)-walHeader) < uint64(n) {
+		return walRecord{}, 0, false
+	}
+	payload := data[walHeader : walHeader+int(n)]
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(data) {
+		return walRecord{}, 0, false
+	}
+	if len(payload) < 1 || (payload[0] != walSet && payload[0] != walDelete) {
+		return walRecord{}, 0, false
+	}
+	keyLen, k := binary.Uvarint(payload[1:])
+	if k <= 0 || keyLen > uint64(len(payload)-1-k) {
+		return walRecord{}, 0, false
+	}
+	rec := walRecord{
+		op:  payload[0],
+		key: string(payload[1+k : 1+k+int(keyLen)]),
+		val: payload[1+k+int(keyLen):],
+	}
+	return rec, walHeader + int(n), true
+}
+
+// 按段存储的WAL，只追加写入当前段，超过segmentSize后切换到下一段
+type wal struct {
+	fs          FS
+	dir         string
+	segmentSize int64
+	seq         uint64 // 当前段的序号
+	file        File   // 当前段
+	size        int64  // 当前段的大小
+	last        int64  // 最后一条记录在当前段中的位置
+	dirty       bool   // 是否有未sync的写入
+}
+
+// 读取一个段中所有完整的记录
+// 遇到不完整或校验失败的记录就停止，返回之前记录的总长度
+func readSegment(fs FS, name string, f func(rec walRecord)) (int64, int64, error) {
+	file, err := fs.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		return 0, 0, err
+	}
+	offset := 0
+	for offset < len(data) {
+		rec, n, ok := decodeWALRecord(data[offset:])
+		if !ok {
+			break
+		}
+		f(rec)
+		offset += n
+	}
+	return int64(offset), int64(len(data)), nil
+}
+
+// 追加一条记录，写入失败时将段截断到写入之前，保证之后的记录不会跟在残缺的记录后面
+func (w *wal) append(rec walRecord) error {
+	if w.file == nil {
+		return ErrWALClosed
+	}
+	buf := rec.encode()
+	if w.size > 0 && w.size+int64(len(buf)) > w.segmentSize {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := w.file.Write(buf)
+	if err != nil {
+		if n > 0 {
+			if terr := w.file.Truncate(w.size); terr != nil {
+				w.close()
+				return fmt.Errorf("%w, truncate: %v", err, terr)
+			}
+		}
+		return err
+	}
+	w.last = w.size
+	w.size += int64(n)
+	w.dirty = true
+	return nil
+}
+
+// 追加一条记录并sync，sync失败时截断这条记录，重启后不会重放
+func (w *wal) appendSync(rec walRecord) error {
+	if err := w.append(rec); err != nil {
+		return err
+	}
+	err := w.sync()
+	if err == nil {
+		return nil
+	}
+	if terr := w.file.Truncate(w.last); terr != nil {
+		w.close()
+		return fmt.Errorf("%w, truncate: %v", err, terr)
+	}
+	w.size = w.last
+	return err
+}
+
+// 将当前段写入磁盘
+func (w *wal) sync() error {
+	if w.file == nil || !w.dirty {
+		return nil
+	}
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	w.dirty = false
+	return nil
+}
+
+// 关闭当前段，创建下一段
+func (w *wal) rotate() error {
+	if err := w.sync(); err != nil {
+		return err
+	}
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+	return w.openSegment(w.seq+1, 0)
+}
+
+// 打开序号为seq的段用于追加，size为段中有效数据的长度
+func (w *wal) openSegment(seq uint64, size int64) error {
+	file, err := w.fs.OpenFile(w.segmentName(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	w.seq = seq
+	w.file = file
+	w.size = size
+	return nil
+}
+
+func (w *wal) close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.sync()
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	w.file = nil
+	return err
+}
+
+func (w *wal) segmentName(seq uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf(walSegmentFmt, seq))
+}
+
+func (w *wal) snapshotName(seq uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf(snapshotFmt, seq))
+}
+
+// 目录下所有段和快照的序号，从小到大排序
+func listWAL(fs FS, dir string) ([]uint64, []uint64, error) {
+	names, err := fs.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var segments, snapshots []uint64
+	for _, name := range names {
+		var seq uint64
+		if strings.HasPrefix(name, "wal-") {
+			if _, err := fmt.Sscanf(name, walSegmentFmt, &seq); err == nil && name == fmt.Sprintf(walSegmentFmt, seq) {
+				segments = append(segments, seq)
+			}
+		} else if strings.HasPrefix(name, "snapshot-") {
+			if _, err := fmt.Sscanf(name, snapshotFmt, &seq); err == nil && name == fmt.Sprintf(snapshotFmt, seq) {
+				snapshots = append(snapshots, seq)
+			}
+		}
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i] < snapshots[j] })
+	return segments, snapshots, nil
+}
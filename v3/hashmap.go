@@ -0,0 +1,321 @@
+package v3
+
+import (
+	"hash/maphash"
+	"math/bits"
+)
+
+// 控制字节，与abseil的swiss table相同
+// 最高位为0表示槽位有效，低7位为哈希值的H2
+const (
+	ctrlEmpty   = 0x80 // 0b1000_0000 槽位为空
+	ctrlDeleted = 0xfe // 0b1111_1110 槽位已删除，查找时不能停止
+)
+
+// 8个字节同时比较用到的常量，groupSize为一个控制字中的槽位个数
+const (
+	groupSize = 8
+	lsb       = 0x0101010101010101
+	msb       = 0x8080808080808080
+)
+
+type hmap struct {
+	count   uint         // map内所有元素个数
+	deleted uint         // 已删除的槽位个数
+	b       uint8        // 当前设置2^b为探测组的个数
+	width   uint8        // 每个探测组包含的控制字个数，1为8个槽位一组，2为16个槽位一组
+	groups  []group      // 所有控制字，按探测组连续存放
+	cap     uint         // 初始化时，预设的map容量
+	mapHash Hash         //hash函数
+	seed    maphash.Seed // 类似于hash0
+}
+
+type Option func(hm *hmap)
+
+// 设置每组的槽位个数，只能为8或16
+// 16个槽位一组时控制字节占用两个uint64，探测时依次比较，探测序列更短
+func WithGroupSize(n int) Option {
+	return func(hm *hmap) {
+		if n != groupSize && n != 2*groupSize {
+			panic("group size error")
+		}
+		hm.width = uint8(n / groupSize)
+	}
+}
+
+func NewHMap(cap int, opts ...Option) *hmap {
+	if cap < 0 || cap > 1<<30 {
+		panic("cap error")
+	}
+	return makemap(uint(cap), opts...)
+}
+
+func (hm *hmap) Set(key string, val interface{}) {
+	if hm.set(key, val) {
+		hm.count++
+	}
+}
+func (hm *hmap) Get(key string) (interface{}, bool) {
+	return hm.get(key)
+}
+func (hm *hmap) Delete(key string) {
+	if hm.del(key) {
+		hm.count--
+	}
+}
+func (hm *hmap) Count() int {
+	return int(hm.count)
+}
+
+// 返回值表示是否属于新增
+func (hm *hmap) set(key string, val interface{}) bool {
+	hash := hm.mapHash.Hash(key)
+	_, g, i, ok := hm.find(key, hash)
+	if ok {
+		g.vals[i] = val
+		return false
+	}
+	// 新增元素前判断是否需要扩容
+	if hm.testhashGrow() {
+		hm.hashGrow()
+	}
+	hm.insert(key, val, hash)
+	return true
+}
+func (hm *hmap) get(key string) (interface{}, bool) {
+	_, g, i, ok := hm.find(key, hm.mapHash.Hash(key))
+	if ok {
+		return g.vals[i], true
+	}
+	return nil, false
+}
+
+// 删除后，如果探测组中还有空槽位，说明探测不会经过这个组，直接置为空
+// 否则置为已删除，保证之后的探测不会提前结束
+func (hm *hmap) del(key string) bool {
+	gs, g, i, ok := hm.find(key, hm.mapHash.Hash(key))
+	if !ok {
+		return false
+	}
+	if hasEmpty(gs) {
+		g.setCtrl(i, ctrlEmpty)
+	} else {
+		g.setCtrl(i, ctrlDeleted)
+		hm.deleted++
+	}
+	g.keys[i] = ""
+	g.vals[i] = nil
+	return true
+}
+
+// 按探测序列查找key所在的探测组，控制字和槽位
+// 遇到有空槽位的探测组，说明key不存在
+func (hm *hmap) find(key string, hash uint64) ([]group, *group, uint8, bool) {
+	h2 := calH2(hash)
+	seq := makeProbeSeq(calH1(hash), hm.groupmask())
+	for ; ; seq = seq.next() {
+		gs := hm.groupAt(seq.offset)
+		for j := range gs {
+			g := &gs[j]
+			for match := g.matchH2(h2); match != 0; match = match.removeFirst() {
+				i := match.first()
+				if key == g.keys[i] {
+					return gs, g, i, true
+				}
+			}
+		}
+		if hasEmpty(gs) {
+			return nil, nil, 0, false
+		}
+	}
+}
+
+// 插入一个不存在的key，放到探测序列中第一个空或已删除的槽位
+func (hm *hmap) insert(key string, val interface{}, hash uint64) {
+	seq := makeProbeSeq(calH1(hash), hm.groupmask())
+	for ; ; seq = seq.next() {
+		gs := hm.groupAt(seq.offset)
+		for j := range gs {
+			g := &gs[j]
+			match := g.matchEmptyOrDeleted()
+			if match == 0 {
+				continue
+			}
+			i := match.first()
+			if g.ctrl(i) == ctrlDeleted {
+				hm.deleted--
+			}
+			g.setCtrl(i, calH2(hash))
+			g.keys[i] = key
+			g.vals[i] = val
+			return
+		}
+	}
+}
+
+// 第offset个探测组的所有控制字
+func (hm *hmap) groupAt(offset uint64) []group {
+	w := uint64(hm.width)
+	return hm.groups[offset*w : offset*w+w]
+}
+
+// 一次性扩容
+// 已删除的槽位较多时等量重建，否则翻倍
+func (hm *hmap) hashGrow() {
+	B := hm.b
+	if hm.deleted < hm.capacity()/4 {
+		B++
+	}
+	oldgroups := hm.groups
+	hm.b = B
+	hm.groups = groupSliceMake(B, hm.width)
+	hm.deleted = 0
+	for i := range oldgroups {
+		g := &oldgroups[i]
+		for match := g.matchFull(); match != 0; match = match.removeFirst() {
+			j := match.first()
+			hm.insert(g.keys[j], g.vals[j], hm.mapHash.Hash(g.keys[j]))
+		}
+	}
+}
+
+// 是否满足扩容条件
+// 有效和已删除的槽位超过7/8
+func (hm *hmap) testhashGrow() bool {
+	return overLoadFactor(hm.count+hm.deleted+1, hm.capacity())
+}
+
+// 槽位的个数
+func (hm *hmap) capacity() uint {
+	return uint(len(hm.groups)) * groupSize
+}
+
+// 探测组的掩码
+func (hm *hmap) groupmask() uint64 {
+	return uint64(1)<<hm.b - 1
+}
+
+// 是否满足扩容条件
+// 如果装载因子超过7/8，则返回true
+func overLoadFactor(count uint, capacity uint) bool {
+	return count > capacity*7/8
+}
+
+func makemap(cap uint, opts ...Option) *hmap {
+	h := new(hmap)
+	h.cap = cap
+	h.width = 1
+	for _, opt := range opts {
+		opt(h)
+	}
+	B := uint8(0)
+	for overLoadFactor(cap, uint(h.width)*groupSize<<B) {
+		B++
+	}
+	h.b = B
+	h.groups = groupSliceMake(B, h.width)
+	h.seed = maphash.MakeSeed()
+	hash := newMapHash(h.seed)
+	h.mapHash = hash
+	return h
+}
+
+// 8个槽位和它们的控制字，控制字节放在一个uint64中，可以同时比较
+// 一个探测组由1个或2个group组成
+type group struct {
+	ctrls uint64
+	keys  [groupSize]string
+	vals  [groupSize]interface{}
+}
+
+func (g *group) ctrl(i uint8) uint8 {
+	return uint8(g.ctrls >> (8 * i))
+}
+
+func (g *group) setCtrl(i uint8, c uint8) {
+	g.ctrls = g.ctrls&^(0xff<<(8*i)) | uint64(c)<<(8*i)
+}
+
+// 控制字节等于h2的槽位
+// 可能有误判，需要再比较key
+func (g *group) matchH2(h2 uint8) bitset {
+	x := g.ctrls ^ (lsb * uint64(h2))
+	return bitset((x - lsb) &^ x & msb)
+}
+
+// 为空的槽位
+func (g *group) matchEmpty() bitset {
+	return bitset(g.ctrls &^ (g.ctrls << 6) & msb)
+}
+
+// 为空或已删除的槽位
+func (g *group) matchEmptyOrDeleted() bitset {
+	return bitset(g.ctrls & msb)
+}
+
+// 有效的槽位
+func (g *group) matchFull() bitset {
+	return bitset(^g.ctrls & msb)
+}
+
+// 每个字节的最高位表示对应的槽位是否匹配
+type bitset uint64
+
+// 第一个匹配的槽位
+func (b bitset) first() uint8 {
+	return uint8(bits.TrailingZeros64(uint64(b)) >> 3)
+}
+
+// 去掉第一个匹配的槽位
+func (b bitset) removeFirst() bitset {
+	return b & (b - 1)
+}
+
+// 二次探测，依次访问offset，offset+1，offset+1+2，...
+// 组的个数为2的幂，可以访问到所有的组
+type probeSeq struct {
+	mask   uint64
+	offset uint64
+	index  uint64
+}
+
+func makeProbeSeq(hash uint64, mask uint64) probeSeq {
+	return probeSeq{
+		mask:   mask,
+		offset: hash & mask,
+	}
+}
+
+func (s probeSeq) next() probeSeq {
+	s.index++
+	s.offset = (s.offset + s.index) & s.mask
+	return s
+}
+
+// 探测组中是否有空槽位
+func hasEmpty(gs []group) bool {
+	for i := range gs {
+		if gs[i].matchEmpty() != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func groupSliceMake(b uint8, width uint8) []group {
+	s := make([]group, int(width)<<b)
+	for i := range s {
+		s[i].ctrls = lsb * ctrlEmpty
+	}
+	return s
+}
+
+// 计算H1，也就是hash值去掉低7位，用于选择组
+func calH1(hash uint64) uint64 {
+	return hash >> 7
+}
+
+// 计算H2，也就是hash值的低7位，存放在控制字节中
+func calH2(hash uint64) uint8 {
+	return uint8(hash & 0x7f)
+}